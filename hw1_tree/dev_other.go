@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// there is no device ID outside of unix, -x does nothing
+func statDevice(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
 )
 
 type byFileName []os.FileInfo
@@ -13,29 +21,230 @@ func (a byFileName) Len() int           { return len(a) }
 func (a byFileName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a byFileName) Less(i, j int) bool { return a[i].Name() < a[j].Name() }
 
+// nameMode is how file names with non-printable characters are shown
+type nameMode int
+
+const (
+	namesAuto   nameMode = iota // escape when writing to a terminal, raw otherwise
+	namesRaw                    // as is
+	namesQuote                  // -q: non-printables replaced with ?
+	namesEscape                 // -N, --escape: C-style escapes
+)
+
+// Options controls what dirTreeOpts prints
+type Options struct {
+	PrintFiles bool     // -f: print files, not only directories
+	Stats      bool     // --stats: per-directory counts by extension and a grand-total table
+	Lines      bool     // --lines: count text lines per regular file, binary files are skipped
+	Names      nameMode // -q or -N/--escape
+	OneFS      bool     // -x: do not descend into directories on other filesystems
+	MaxEntries int      // stop after this many entries, 0 means no limit
+	MaxBytes   int64    // stop before writing more than this many bytes, truncation line included, 0 means no limit, must fit the truncation line
+}
+
+var (
+	// ErrTruncated is returned by DirTreeContext when the output is not complete
+	ErrTruncated = errors.New("tree output truncated")
+	// ErrMaxEntries is the reason of ErrTruncated when Options.MaxEntries entries were printed
+	ErrMaxEntries = errors.New("max entries reached")
+	// ErrMaxBytes is the reason of ErrTruncated when the next entry would not fit into Options.MaxBytes
+	ErrMaxBytes = errors.New("max bytes reached")
+	// ErrMaxBytesTooSmall is returned by DirTreeContext when Options.MaxBytes has no room for the truncation line
+	ErrMaxBytesTooSmall = errors.New("max bytes too small for the truncation line")
+)
+
+// markerReserve is the room kept under Options.MaxBytes for the longest truncation line
+var markerReserve = func() int64 {
+	var longest int
+	for _, reason := range []error{ErrMaxEntries, ErrMaxBytes, context.Canceled, context.DeadlineExceeded} {
+		longest = max(longest, len(truncationLine(fmt.Errorf("%w: %w", ErrTruncated, reason))))
+	}
+	return int64(longest) + 1 //and the newline before it
+}()
+
+func truncationLine(err error) string {
+	return fmt.Sprintf("[%v]\n", err)
+}
+
+// extStat is a count of files with one extension
+type extStat struct {
+	files  int
+	bytes  int64
+	lines  int
+	binary int
+}
+
+// treeWalker keeps the state shared by the whole walk,
+// every entry is collected in buf and written to dst when the next one starts
+type treeWalker struct {
+	ctx     context.Context
+	dst     io.Writer
+	buf     bytes.Buffer
+	out     io.Writer
+	opts    Options
+	total   map[string]*extStat
+	rootDev uint64
+	entries int
+	written int64
+	held    []int //ends of complete entries at the start of buf that flush kept back for MaxBytes
+}
+
+// deviceOf returns the ID of the device a file is on, replaced in tests
+var deviceOf = statDevice
+
 func main() {
 	out := os.Stdout
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
+	path, opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		panic("usage go run main.go . [-f] [--stats] [--lines] [-q|-N] [-x]")
 	}
-	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
+	err = dirTreeOpts(out, path, opts)
 	if err != nil {
 		panic(err.Error())
 	}
 }
 
+func parseArgs(args []string) (string, Options, error) {
+	var path string
+	var opts Options
+	for _, arg := range args {
+		switch arg {
+		case "-f":
+			opts.PrintFiles = true
+		case "--stats":
+			opts.Stats = true
+		case "--lines":
+			opts.Lines = true
+		case "-q":
+			opts.Names = namesQuote
+		case "-N", "--escape":
+			opts.Names = namesEscape
+		case "-x":
+			opts.OneFS = true
+		default:
+			if path != "" || strings.HasPrefix(arg, "-") {
+				return "", opts, fmt.Errorf("unexpected argument %q", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return "", opts, fmt.Errorf("no path given")
+	}
+	return path, opts, nil
+}
+
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
 func dirTree(out io.Writer, path string, isPrintFiles bool) error {
-	err := dirTreeDeep(out, path, isPrintFiles, []rune{})
+	return dirTreeOpts(out, path, Options{PrintFiles: isPrintFiles})
+}
+
+func dirTreeOpts(out io.Writer, path string, opts Options) error {
+	return DirTreeContext(context.Background(), out, path, opts)
+}
+
+// DirTreeContext prints the tree like dirTree, but stops when ctx is done or
+// a limit from opts is reached. Partial output ends with a truncation line and
+// the error matches ErrTruncated and the reason (ctx.Err(), ErrMaxEntries or ErrMaxBytes)
+func DirTreeContext(ctx context.Context, out io.Writer, path string, opts Options) error {
+	if opts.MaxBytes > 0 && opts.MaxBytes < markerReserve {
+		return fmt.Errorf("%w: %d, need at least %d", ErrMaxBytesTooSmall, opts.MaxBytes, markerReserve)
+	}
+	if opts.Names == namesAuto {
+		opts.Names = namesRaw
+		if isTerminal(out) {
+			opts.Names = namesEscape
+		}
+	}
+	w := &treeWalker{ctx: ctx, dst: out, opts: opts, total: map[string]*extStat{}}
+	w.out = &w.buf
+	if opts.OneFS {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		w.rootDev, _ = deviceOf(fi)
+	}
+	err := w.dirTreeDeep(path, []rune{})
+	if err == nil {
+		fmt.Fprint(w.out, "\n")
+		if opts.Stats {
+			w.printTotals()
+		}
+		err = w.flush(true)
+	}
 	if err != nil {
+		if errors.Is(err, ErrTruncated) {
+			line := truncationLine(err)
+			for i := len(w.held) - 1; i >= 0; i-- { //as many entries kept back by flush as fit with the line
+				if w.written+int64(w.held[i]+1+len(line)) <= opts.MaxBytes {
+					w.write(w.held[i])
+					break
+				}
+			}
+			if w.written != 0 {
+				fmt.Fprint(out, "\n")
+			}
+			fmt.Fprint(out, line)
+		}
+		return err
+	}
+	return nil
+}
+
+// nextEntry is called before every entry, it writes the previous one and checks limits
+func (w *treeWalker) nextEntry() error {
+	if err := w.flush(false); err != nil {
 		return err
 	}
-	fmt.Fprint(out, "\n")
+	if err := w.ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	if w.opts.MaxEntries > 0 && w.entries >= w.opts.MaxEntries {
+		return fmt.Errorf("%w: %w", ErrTruncated, ErrMaxEntries)
+	}
+	w.entries++
 	return nil
 }
 
-func dirTreeDeep(out io.Writer, path string, isPrintFiles bool, deepSl []rune) error {
+// flush writes the buffered entries. With MaxBytes the last markerReserve bytes are written
+// only by the final flush, so a truncation line always fits under the limit
+func (w *treeWalker) flush(final bool) error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	if limit := w.opts.MaxBytes; limit > 0 {
+		size := w.written + int64(w.buf.Len())
+		if size > limit {
+			return fmt.Errorf("%w: %w", ErrTruncated, ErrMaxBytes)
+		}
+		if !final && size > limit-markerReserve {
+			w.held = append(w.held, w.buf.Len()) //keep it until we know whether the tree ends here
+			return nil
+		}
+	}
+	return w.write(w.buf.Len())
+}
+
+// write writes the first n buffered bytes and drops the rest of the buffer
+func (w *treeWalker) write(n int) error {
+	n, err := w.dst.Write(w.buf.Bytes()[:n])
+	w.written += int64(n)
+	w.buf.Reset()
+	w.held = w.held[:0]
+	return err
+}
+
+func (w *treeWalker) dirTreeDeep(path string, deepSl []rune) error {
+	out := w.out
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -49,9 +258,37 @@ func dirTreeDeep(out io.Writer, path string, isPrintFiles bool, deepSl []rune) e
 
 	sort.Sort(byFileName(filesSlice)) //need to sort?
 
+	lineNotes := map[string]string{} //--lines suffix per file
+	if w.opts.Stats || w.opts.Lines {
+		dirStat := map[string]*extStat{}
+		for _, val := range filesSlice {
+			if val.IsDir() {
+				continue
+			}
+			if err := w.ctx.Err(); err != nil {
+				return fmt.Errorf("%w: %w", ErrTruncated, err)
+			}
+			var n int
+			kind := kindUnread
+			if w.opts.Lines { //--stats alone needs only sizes
+				n, kind, lineNotes[val.Name()] = lineNote(path+string(os.PathSeparator)+val.Name(), val)
+			}
+			if w.opts.Stats {
+				addStat(dirStat, val, n, kind)
+				addStat(w.total, val, n, kind)
+			}
+		}
+		if w.opts.Stats && len(deepSl) != 0 && len(dirStat) != 0 {
+			fmt.Fprintf(out, " [%s]", formatDirStat(dirStat))
+		}
+	}
+
 	var idxFolder int
 	for idx, val := range filesSlice {
 		if val.IsDir() {
+			if err := w.nextEntry(); err != nil {
+				return err
+			}
 			if len(deepSl) != 0 || idx != 0 {
 				fmt.Fprint(out, "\n")
 			}
@@ -62,24 +299,32 @@ func dirTreeDeep(out io.Writer, path string, isPrintFiles bool, deepSl []rune) e
 				}
 				fmt.Fprint(out, "\t")
 			}
-			if idx == len(filesSlice)-1 || (idxFolder >= countFolders(&filesSlice)-1 && !isPrintFiles) {
-				fmt.Fprintf(out, "└───%s", val.Name())
+			if idx == len(filesSlice)-1 || (idxFolder >= countFolders(&filesSlice)-1 && !w.opts.PrintFiles) {
+				fmt.Fprintf(out, "└───%s", w.displayName(val.Name()))
 				deepSl = append(deepSl, ' ') //empty rune?
 			} else {
-				fmt.Fprintf(out, "├───%s", val.Name())
+				fmt.Fprintf(out, "├───%s", w.displayName(val.Name()))
 				deepSl = append(deepSl, '│')
 			}
 
 			idxFolder++
-			err := dirTreeDeep(out, path+string(os.PathSeparator)+val.Name(), isPrintFiles, deepSl)
+			if w.isOtherFS(val) {
+				fmt.Fprint(out, " [mount point]")
+				deepSl = deepSl[:len(deepSl)-1]
+				continue
+			}
+			err := w.dirTreeDeep(path+string(os.PathSeparator)+val.Name(), deepSl)
 			if err != nil {
-				panic(err.Error())
+				return err
 			}
 			deepSl = deepSl[:len(deepSl)-1]
 		} else {
-			if !isPrintFiles {
+			if !w.opts.PrintFiles {
 				continue
 			}
+			if err := w.nextEntry(); err != nil {
+				return err
+			}
 			if len(deepSl) != 0 || idx != 0 {
 				fmt.Fprint(out, "\n")
 			}
@@ -91,9 +336,9 @@ func dirTreeDeep(out io.Writer, path string, isPrintFiles bool, deepSl []rune) e
 
 			}
 			if idx == len(filesSlice)-1 {
-				fmt.Fprintf(out, "└───%s", val.Name())
+				fmt.Fprintf(out, "└───%s", w.displayName(val.Name()))
 			} else {
-				fmt.Fprintf(out, "├───%s", val.Name())
+				fmt.Fprintf(out, "├───%s", w.displayName(val.Name()))
 			}
 
 			if val.Size() != 0 {
@@ -101,6 +346,10 @@ func dirTreeDeep(out io.Writer, path string, isPrintFiles bool, deepSl []rune) e
 			} else {
 				fmt.Fprint(out, " (empty)")
 			}
+
+			if w.opts.Lines {
+				fmt.Fprint(out, lineNotes[val.Name()])
+			}
 		}
 	}
 	return err
@@ -115,3 +364,227 @@ func countFolders(sl *[]os.FileInfo) int {
 	}
 	return countFolders
 }
+
+// isOtherFS reports whether -x is set and dir is on another device than the root
+func (w *treeWalker) isOtherFS(dir os.FileInfo) bool {
+	if !w.opts.OneFS {
+		return false
+	}
+	dev, ok := deviceOf(dir)
+	return ok && dev != w.rootDev
+}
+
+func (w *treeWalker) displayName(name string) string {
+	switch w.opts.Names {
+	case namesQuote:
+		return quoteName(name)
+	case namesEscape:
+		return escapeName(name)
+	}
+	return name
+}
+
+// quoteName replaces every non-printable character or invalid UTF-8 byte with ?
+func quoteName(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if (r == utf8.RuneError && size == 1) || !unicode.IsPrint(r) {
+			sb.WriteByte('?')
+		} else {
+			sb.WriteString(name[i : i+size])
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+var cEscapes = map[rune]string{
+	'\a': `\a`, '\b': `\b`, '\f': `\f`, '\n': `\n`,
+	'\r': `\r`, '\t': `\t`, '\v': `\v`, '\\': `\\`,
+}
+
+// escapeName writes non-printable characters as C escapes, \n, \t and so on,
+// other control characters and invalid UTF-8 bytes as octal \ooo
+func escapeName(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if esc, ok := cEscapes[r]; ok {
+			sb.WriteString(esc)
+		} else if (r == utf8.RuneError && size == 1) || !unicode.IsPrint(r) {
+			for _, b := range []byte(name[i : i+size]) {
+				fmt.Fprintf(&sb, "\\%03o", b)
+			}
+		} else {
+			sb.WriteString(name[i : i+size])
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+// fileExt returns the extension used as a stats key, "-" for files without one
+func fileExt(name string) string {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if ext == "" {
+		return "-"
+	}
+	return ext
+}
+
+func addStat(stats map[string]*extStat, fi os.FileInfo, lines int, kind fileKind) {
+	ext := fileExt(fi.Name())
+	st, ok := stats[ext]
+	if !ok {
+		st = &extStat{}
+		stats[ext] = st
+	}
+	st.files++
+	st.bytes += fi.Size()
+	switch kind {
+	case kindText:
+		st.lines += lines
+	case kindBinary:
+		st.binary++
+	}
+}
+
+func sortedExts(stats map[string]*extStat) []string {
+	exts := make([]string, 0, len(stats))
+	for ext := range stats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// formatDirStat renders stats as "png:1 70372b, txt:1 19b"
+func formatDirStat(stats map[string]*extStat) string {
+	parts := make([]string, 0, len(stats))
+	for _, ext := range sortedExts(stats) {
+		parts = append(parts, fmt.Sprintf("%s:%d %db", ext, stats[ext].files, stats[ext].bytes))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (w *treeWalker) printTotals() {
+	tw := tabwriter.NewWriter(w.out, 0, 8, 2, ' ', 0)
+	header := "ext\tfiles\tbytes"
+	if w.opts.Lines {
+		header += "\tlines\tbinary"
+	}
+	fmt.Fprintln(tw, header)
+	sum := &extStat{}
+	for _, ext := range sortedExts(w.total) {
+		st := w.total[ext]
+		w.printStatRow(tw, ext, st)
+		sum.files += st.files
+		sum.bytes += st.bytes
+		sum.lines += st.lines
+		sum.binary += st.binary
+	}
+	w.printStatRow(tw, "total", sum)
+	tw.Flush()
+}
+
+func (w *treeWalker) printStatRow(out io.Writer, name string, st *extStat) {
+	if w.opts.Lines {
+		fmt.Fprintf(out, "%s\t%d\t%d\t%d\t%d\n", name, st.files, st.bytes, st.lines, st.binary)
+		return
+	}
+	fmt.Fprintf(out, "%s\t%d\t%d\n", name, st.files, st.bytes)
+}
+
+// fileKind is what --lines found in a file
+type fileKind int
+
+const (
+	kindUnread fileKind = iota // not read: --lines is off, not a regular file or cannot be opened
+	kindText
+	kindBinary
+)
+
+// lineNote counts lines of a regular file and returns the --lines suffix for it.
+// Other files (FIFOs, sockets, devices) are never opened, a FIFO would block forever
+func lineNote(path string, fi os.FileInfo) (int, fileKind, string) {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			return 0, kindUnread, " [unreadable]"
+		}
+		fi = target
+	}
+	if !fi.Mode().IsRegular() {
+		return 0, kindUnread, ""
+	}
+	n, isText, err := countLines(path)
+	switch {
+	case err != nil:
+		return 0, kindUnread, " [unreadable]"
+	case isText:
+		return n, kindText, fmt.Sprintf(" [lines: %d]", n)
+	}
+	return 0, kindBinary, " [binary]"
+}
+
+// isText reports whether head, the start of a file, is UTF-8 text without NUL bytes.
+// If the file goes on after head, a rune cut at the end of head is not an error
+func isText(head []byte, more bool) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	if more {
+		for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(head[i]) {
+				if !utf8.FullRune(head[i:]) {
+					head = head[:i]
+				}
+				break
+			}
+		}
+	}
+	return utf8.Valid(head)
+}
+
+// sniffLen is how many first bytes of a file decide whether it is text
+const sniffLen = 512
+
+// countLines counts lines of a text file, a file is treated as binary
+// if its first sniffLen bytes do not look like text, see isText
+func countLines(path string) (int, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 32*1024)
+	n, err := io.ReadFull(file, buf[:sniffLen])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, false, err
+	}
+	if !isText(buf[:n], err == nil) {
+		return 0, false, nil
+	}
+
+	var lines int
+	last := byte('\n')
+	for {
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err != nil {
+			break
+		}
+		n, err = file.Read(buf)
+		if err != nil && err != io.EOF {
+			return 0, false, err
+		}
+	}
+	if last != '\n' {
+		lines++ //last line without \n
+	}
+	return lines, true, nil
+}
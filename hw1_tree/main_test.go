@@ -2,6 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -73,3 +78,221 @@ func TestTreeDir(t *testing.T) {
 		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
 	}
 }
+
+const testStatsResult = `├───project [png:1 70372b, txt:1 19b]
+├───static [txt:1 0b]
+│	├───a_lorem [png:1 70372b, txt:1 0b]
+│	│	└───ipsum [png:1 70372b]
+│	├───css [css:1 28b]
+│	├───html [html:1 57b]
+│	├───js [js:1 10b]
+│	└───z_lorem [png:1 70372b, txt:1 0b]
+│		└───ipsum [png:1 70372b]
+└───zline [txt:1 0b]
+	└───lorem [png:1 70372b, txt:1 0b]
+		└───ipsum [png:1 70372b]
+ext    files  bytes
+css    1      28
+html   1      57
+js     1      10
+png    7      492604
+txt    7      19
+total  17     492718
+`
+
+func TestTreeStats(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", Options{Stats: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testStatsResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testStatsResult)
+	}
+}
+
+const testLinesResult = `├───project [png:1 70372b, txt:1 19b]
+│	├───file.txt (19b) [lines: 1]
+│	└───gopher.png (70372b) [binary]
+`
+
+func TestTreeLines(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", Options{PrintFiles: true, Lines: true, Stats: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if !strings.HasPrefix(result, testLinesResult) {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected prefix:\n%v", result, testLinesResult)
+	}
+	if !strings.HasSuffix(result, "total  17     492718  7      7\n") {
+		t.Errorf("test for OK Failed - wrong totals\nGot:\n%v", result)
+	}
+}
+
+func oddNamesDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, name := range []string{"new\nline", "tab\tname", "ctl\x01", "bad\xffutf", "ok.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Skipf("cannot create %q: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestTreeOddNames(t *testing.T) {
+	dir := oddNamesDir(t)
+	cases := []struct {
+		names    nameMode
+		expected string
+	}{
+		{namesQuote, "├───bad?utf (empty)\n├───ctl? (empty)\n├───new?line (empty)\n├───ok.txt (empty)\n└───tab?name (empty)\n"},
+		{namesEscape, "├───bad\\377utf (empty)\n├───ctl\\001 (empty)\n├───new\\nline (empty)\n├───ok.txt (empty)\n└───tab\\tname (empty)\n"},
+	}
+	for _, c := range cases {
+		out := new(bytes.Buffer)
+		err := dirTreeOpts(out, dir, Options{PrintFiles: true, Names: c.names})
+		if err != nil {
+			t.Errorf("test for OK Failed - error")
+		}
+		result := out.String()
+		if result != c.expected {
+			t.Errorf("test for OK Failed - results not match\nGot:\n%q\nExpected:\n%q", result, c.expected)
+		}
+	}
+
+	// raw names are not touched when the output is not a terminal
+	out := new(bytes.Buffer)
+	if err := dirTree(out, dir, true); err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	if !strings.Contains(out.String(), "new\nline") {
+		t.Errorf("raw name expected\nGot:\n%q", out.String())
+	}
+}
+
+const testOneFSResult = `├───project
+├───static [mount point]
+└───zline
+	└───lorem
+		└───ipsum
+`
+
+func TestTreeOneFS(t *testing.T) {
+	defer func(orig func(os.FileInfo) (uint64, bool)) { deviceOf = orig }(deviceOf)
+	deviceOf = func(fi os.FileInfo) (uint64, bool) {
+		if fi.Name() == "static" {
+			return 2, true
+		}
+		return 1, true
+	}
+
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", Options{OneFS: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testOneFSResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testOneFSResult)
+	}
+}
+
+// cancelWriter cancels the walk after the first write
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestTreeContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &cancelWriter{cancel: cancel}
+	err := DirTreeContext(ctx, out, "testdata", Options{PrintFiles: true})
+	if !errors.Is(err, ErrTruncated) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected truncated and canceled error, got %v", err)
+	}
+	expected := "├───project\n[tree output truncated: context canceled]\n"
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+}
+
+func TestTreeContextLimits(t *testing.T) {
+	lines := strings.Split(testFullResult, "\n")
+	head := strings.Join(lines[:3], "\n")
+
+	out := new(bytes.Buffer)
+	err := DirTreeContext(context.Background(), out, "testdata", Options{PrintFiles: true, MaxEntries: 3})
+	if !errors.Is(err, ErrTruncated) || !errors.Is(err, ErrMaxEntries) {
+		t.Fatalf("expected max entries error, got %v", err)
+	}
+	expected := head + "\n[tree output truncated: max entries reached]\n"
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+
+	out.Reset()
+	marker := "\n[tree output truncated: max bytes reached]\n"
+	limit := int64(len(head) + len(marker) + 5)
+	err = DirTreeContext(context.Background(), out, "testdata", Options{PrintFiles: true, MaxBytes: limit})
+	if !errors.Is(err, ErrTruncated) || !errors.Is(err, ErrMaxBytes) {
+		t.Fatalf("expected max bytes error, got %v", err)
+	}
+	expected = head + marker
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+
+	// the truncation line is part of the limit
+	for limit := markerReserve; limit < int64(len(testFullResult)); limit++ {
+		out.Reset()
+		err = DirTreeContext(context.Background(), out, "testdata", Options{PrintFiles: true, MaxBytes: limit})
+		if !errors.Is(err, ErrMaxBytes) || int64(out.Len()) > limit || !strings.HasSuffix(out.String(), "max bytes reached]\n") {
+			t.Fatalf("limit %d: got %d bytes, error %v\n%v", limit, out.Len(), err, out.String())
+		}
+	}
+
+	for _, limit := range []int64{1, 10, 30, markerReserve - 1} {
+		out.Reset()
+		err = DirTreeContext(context.Background(), out, "testdata", Options{PrintFiles: true, MaxBytes: limit})
+		if !errors.Is(err, ErrMaxBytesTooSmall) || out.Len() != 0 {
+			t.Errorf("limit %d smaller than the truncation line: got %d bytes, error %v", limit, out.Len(), err)
+		}
+	}
+
+	out.Reset()
+	err = DirTreeContext(context.Background(), out, "testdata", Options{PrintFiles: true, MaxBytes: int64(len(testFullResult))})
+	if err != nil || out.String() != testFullResult {
+		t.Errorf("exact limit must not truncate, got %v\n%v", err, out.String())
+	}
+}
+
+func TestIsText(t *testing.T) {
+	cut := []byte("строка")[:3] //"с" и первый байт "т"
+	cases := []struct {
+		name string
+		head []byte
+		more bool
+		text bool
+	}{
+		{"empty", nil, false, true},
+		{"ascii", []byte("hello\n"), false, true},
+		{"utf8", []byte("привет\n"), false, true},
+		{"nul", []byte("a\x00b"), false, false},
+		{"invalid", []byte{0xff, 0xfe, 'a'}, false, false},
+		{"rune cut by sniffLen", cut, true, true},
+		{"rune cut at end of file", cut, false, false},
+	}
+	for _, c := range cases {
+		if got := isText(c.head, c.more); got != c.text {
+			t.Errorf("%s: isText = %v, expected %v", c.name, got, c.text)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// treeNode is a directory or a file of a tree printed by dirTree
+type treeNode struct {
+	Name     string
+	IsDir    bool
+	Size     int64
+	Children []*treeNode
+}
+
+var fileSuffixRe = regexp.MustCompile(` \((?:(\d+)b|empty)\)$`)
+
+// parseTree reads the text produced by dirTree back into a tree,
+// the returned root is an unnamed directory
+func parseTree(r io.Reader) (*treeNode, error) {
+	root := &treeNode{IsDir: true}
+	stack := []*treeNode{root} //parents by depth
+	closed := []bool{false}    //└─── was seen on this depth
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		depth := 0
+		for {
+			if strings.HasPrefix(line, "│\t") {
+				if depth+1 >= len(stack) || closed[depth] {
+					return nil, fmt.Errorf("line %d: unexpected │ on depth %d", lineNum, depth)
+				}
+				line = line[len("│\t"):]
+			} else if strings.HasPrefix(line, "\t") {
+				if depth+1 >= len(stack) || !closed[depth] {
+					return nil, fmt.Errorf("line %d: missing │ on depth %d", lineNum, depth)
+				}
+				line = line[len("\t"):]
+			} else {
+				break
+			}
+			depth++
+		}
+		if depth >= len(stack) {
+			return nil, fmt.Errorf("line %d: too deep", lineNum)
+		}
+		if closed[depth] {
+			return nil, fmt.Errorf("line %d: entry after └───", lineNum)
+		}
+
+		var isLast bool
+		switch {
+		case strings.HasPrefix(line, "├───"):
+			line = line[len("├───"):]
+		case strings.HasPrefix(line, "└───"):
+			line = line[len("└───"):]
+			isLast = true
+		default:
+			return nil, fmt.Errorf("line %d: no ├─── or └───", lineNum)
+		}
+
+		parent := stack[depth]
+		if !parent.IsDir {
+			return nil, fmt.Errorf("line %d: file %q has children", lineNum, parent.Name)
+		}
+		node := &treeNode{Name: line, IsDir: true}
+		if m := fileSuffixRe.FindStringSubmatchIndex(line); m != nil {
+			node.Name = line[:m[0]]
+			node.IsDir = false
+			if m[2] >= 0 {
+				size, err := strconv.ParseInt(line[m[2]:m[3]], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNum, err)
+				}
+				node.Size = size
+			}
+		}
+		parent.Children = append(parent.Children, node)
+
+		closed[depth] = isLast
+		stack = append(stack[:depth+1], node)
+		closed = append(closed[:depth+1], false)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// renderTree prints the tree in the same format as dirTree
+func renderTree(out io.Writer, root *treeNode, isPrintFiles bool) {
+	var printed bool
+	renderTreeDeep(out, root, isPrintFiles, "", &printed)
+	if !printed {
+		fmt.Fprint(out, "\n")
+	}
+}
+
+func renderTreeDeep(out io.Writer, node *treeNode, isPrintFiles bool, prefix string, printed *bool) {
+	var visible []*treeNode
+	for _, child := range node.Children {
+		if child.IsDir || isPrintFiles {
+			visible = append(visible, child)
+		}
+	}
+
+	for idx, child := range visible {
+		*printed = true
+		connector, childPrefix := "├───", prefix+"│\t"
+		if idx == len(visible)-1 {
+			connector, childPrefix = "└───", prefix+"\t"
+		}
+		fmt.Fprintf(out, "%s%s%s", prefix, connector, child.Name)
+		if !child.IsDir {
+			if child.Size != 0 {
+				fmt.Fprintf(out, " (%vb)", child.Size)
+			} else {
+				fmt.Fprint(out, " (empty)")
+			}
+		}
+		fmt.Fprint(out, "\n")
+		if child.IsDir {
+			renderTreeDeep(out, child, isPrintFiles, childPrefix, printed)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	cases := []struct {
+		text         string
+		isPrintFiles bool
+	}{
+		{testFullResult, true},
+		{testDirResult, false},
+		{"\n", true},
+	}
+	for _, c := range cases {
+		root, err := parseTree(strings.NewReader(c.text))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		out := new(bytes.Buffer)
+		renderTree(out, root, c.isPrintFiles)
+		if out.String() != c.text {
+			t.Errorf("round trip failed\nGot:\n%v\nExpected:\n%v", out.String(), c.text)
+		}
+	}
+}
+
+func TestParseFullResult(t *testing.T) {
+	root, err := parseTree(strings.NewReader(testFullResult))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(root.Children) != 4 {
+		t.Fatalf("expected 4 top entries, got %d", len(root.Children))
+	}
+	project := root.Children[0]
+	if project.Name != "project" || !project.IsDir || len(project.Children) != 2 {
+		t.Errorf("bad project node: %+v", project)
+	}
+	gopher := project.Children[1]
+	if gopher.Name != "gopher.png" || gopher.IsDir || gopher.Size != 70372 {
+		t.Errorf("bad gopher.png node: %+v", gopher)
+	}
+	zzfile := root.Children[3]
+	if zzfile.Name != "zzfile.txt" || zzfile.IsDir || zzfile.Size != 0 {
+		t.Errorf("bad zzfile.txt node: %+v", zzfile)
+	}
+
+	// the same tree without files is the -f less output
+	out := new(bytes.Buffer)
+	renderTree(out, root, false)
+	if out.String() != testDirResult {
+		t.Errorf("render without files failed\nGot:\n%v\nExpected:\n%v", out.String(), testDirResult)
+	}
+}
+
+func TestParseDirTreeOutput(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := dirTree(out, "testdata", true); err != nil {
+		t.Fatalf("dirTree failed: %v", err)
+	}
+	root, err := parseTree(out)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(root.Children) != 4 || len(root.Children[1].Children) != 6 {
+		t.Errorf("unexpected tree shape: %+v", root.Children)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	bad := []string{
+		"project\n",                         // no connector
+		"└───a\n├───b\n",                    // entry after the last one
+		"├───a\n\t└───b\n",                  // missing │
+		"└───a\n│\t└───b\n",                 // │ after the last one
+		"├───a\n│\t│\t└───b\n",              // too deep
+		"├───a.txt (1b)\n│\t└───b\n└───c\n", // file with children
+	}
+	for _, text := range bad {
+		if _, err := parseTree(strings.NewReader(text)); err == nil {
+			t.Errorf("expected error for %q", text)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTreeSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644); err != nil {
+		t.Skipf("cannot create fifo: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\n"), 0644)
+	os.Symlink("a.txt", filepath.Join(dir, "link"))
+	os.Symlink("missing", filepath.Join(dir, "m_dangling"))
+
+	cases := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{PrintFiles: true, Stats: true}, "├───a.txt (8b)\n├───fifo (empty)\n├───link (5b)\n└───m_dangling (7b)\n" +
+			"ext    files  bytes\n-      3      12\ntxt    1      8\ntotal  4      20\n"},
+		{Options{PrintFiles: true, Lines: true}, "├───a.txt (8b) [lines: 2]\n├───fifo (empty)\n├───link (5b) [lines: 2]\n└───m_dangling (7b) [unreadable]\n"},
+	}
+	for _, c := range cases {
+		done := make(chan struct{})
+		out := new(bytes.Buffer)
+		var err error
+		go func() {
+			defer close(done)
+			err = dirTreeOpts(out, dir, c.opts)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("tree blocked on a fifo with %+v", c.opts)
+		}
+		if err != nil {
+			t.Errorf("test for OK Failed - error: %v", err)
+		}
+		if result := out.String(); result != c.expected {
+			t.Errorf("test for OK Failed - results not match\nGot:\n%q\nExpected:\n%q", result, c.expected)
+		}
+	}
+}
+
+func TestTreeUnreadableFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any file")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	os.WriteFile(path, []byte("x\n"), 0)
+
+	out := new(bytes.Buffer)
+	if err := dirTreeOpts(out, dir, Options{PrintFiles: true, Lines: true}); err != nil {
+		t.Errorf("test for OK Failed - error: %v", err)
+	}
+	if expected := "└───secret.txt (2b) [unreadable]\n"; out.String() != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%q\nExpected:\n%q", out.String(), expected)
+	}
+}
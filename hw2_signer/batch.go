@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Batch - job, который собирает значения из in в []interface{} и отправляет пачку дальше,
+// когда в ней size значений, когда с первого значения пачки прошло maxWait или когда вход закрыт
+func Batch(size int, maxWait time.Duration) job {
+	return func(in, out chan interface{}) {
+		runAsJob(BatchStage[interface{}](size, maxWait), in, out)
+	}
+}
+
+// Unbatch - job, обратный Batch: каждое значение пачки []interface{} уходит дальше отдельно
+func Unbatch(in, out chan interface{}) {
+	runAsJob(UnbatchStage[interface{}](), in, out)
+}
+
+// BatchStage - Batch как типизированная стадия. maxWait <= 0 - пачка ждёт, пока наберётся size
+func BatchStage[T any](size int, maxWait time.Duration) Stage[T, []T] {
+	size = max(size, 1)
+	return func(ctx context.Context, in <-chan T, out chan<- []T) error {
+		var batch []T
+		var timer *time.Timer
+		var expired <-chan time.Time //nil, пока пачка пустая
+		flush := func() error {
+			if timer != nil {
+				timer.Stop()
+				timer, expired = nil, nil
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			select {
+			case out <- batch:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			batch = make([]T, 0, size) //отправленную пачку читает следующая стадия
+			return nil
+		}
+
+		for {
+			select {
+			case val, ok := <-in:
+				if !ok {
+					return flush()
+				}
+				if batch == nil {
+					batch = make([]T, 0, size)
+				}
+				batch = append(batch, val)
+				if len(batch) == 1 && maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					expired = timer.C
+				}
+				if len(batch) >= size {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			case <-expired:
+				timer, expired = nil, nil
+				if err := flush(); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// UnbatchStage - Unbatch как типизированная стадия
+func UnbatchStage[T any]() Stage[[]T, T] {
+	return func(ctx context.Context, in <-chan []T, out chan<- T) error {
+		for batch := range in {
+			for _, val := range batch {
+				select {
+				case out <- val:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		return nil
+	}
+}
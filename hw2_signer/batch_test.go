@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// как в TestByIlia: проверяем, что все значения дошли, и по времени - что пачки не ждут лишнего
+
+func TestBatchBySize(t *testing.T) {
+	var batches [][]interface{}
+	start := time.Now()
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := uint32(1); i <= 5; i++ {
+				out <- i
+			}
+		}),
+		Batch(2, time.Second),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				batches = append(batches, val.([]interface{}))
+			}
+		}),
+	)
+	end := time.Since(start)
+
+	expected := [][]interface{}{{uint32(1), uint32(2)}, {uint32(3), uint32(4)}, {uint32(5)}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("got batches %v, expected %v", batches, expected)
+	}
+	if expectedTime := 100 * time.Millisecond; end > expectedTime { //закрытый вход не ждёт maxWait
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+}
+
+func TestBatchByTime(t *testing.T) {
+	var recieved uint32
+	var firstBatch time.Duration
+	start := time.Now()
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- uint32(1)
+			out <- uint32(3)
+			time.Sleep(300 * time.Millisecond) //пачка [1 3] должна уйти по maxWait, не дожидаясь 4
+			out <- uint32(4)
+		}),
+		Batch(10, 50*time.Millisecond),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				if firstBatch == 0 {
+					firstBatch = time.Since(start)
+				}
+				for _, v := range val.([]interface{}) {
+					atomic.AddUint32(&recieved, v.(uint32))
+				}
+			}
+		}),
+	)
+	end := time.Since(start)
+
+	if firstBatch < 50*time.Millisecond || firstBatch > 150*time.Millisecond {
+		t.Errorf("first batch after %s, expected about 50ms", firstBatch)
+	}
+	if expectedTime := 350 * time.Millisecond; end > expectedTime {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+	if recieved != 1+3+4 {
+		t.Errorf("sink have not collected inputs, recieved = %d", recieved)
+	}
+}
+
+func TestBatchUnbatch(t *testing.T) {
+	var recieved uint32
+	freeFlowJobs := []job{
+		job(func(in, out chan interface{}) {
+			for _, val := range []uint32{1, 3, 4, 5, 7, 8} {
+				out <- val
+			}
+		}),
+		Batch(3, time.Second),
+		job(func(in, out chan interface{}) { //медленная стадия работает с пачкой целиком
+			for val := range in {
+				batch := val.([]interface{})
+				for i := range batch {
+					batch[i] = batch[i].(uint32) * 3
+				}
+				out <- batch
+				time.Sleep(time.Millisecond * 100)
+			}
+		}),
+		job(Unbatch),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				atomic.AddUint32(&recieved, val.(uint32))
+			}
+		}),
+	}
+
+	start := time.Now()
+	ExecutePipeline(freeFlowJobs...)
+	end := time.Since(start)
+
+	if expectedTime := time.Millisecond * 250; end > expectedTime { //2 пачки по 100ms вместо 6 значений
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+	if recieved != (1+3+4+5+7+8)*3 {
+		t.Errorf("sink have not collected inputs, recieved = %d", recieved)
+	}
+}
+
+func TestBatchStageCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	out := make(chan []int)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- BatchStage[int](10, 0)(ctx, in, out)
+	}()
+	in <- 1
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("stage was not cancelled")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// signMemo - кеш результатов функции подписи на size последних значений (LRU).
+// Одновременные вызовы с одинаковым входом ждут один общий расчёт
+type signMemo struct {
+	fn   func(string) string
+	size int
+
+	mu       sync.Mutex
+	items    map[string]*list.Element //значение *memoEntry
+	lru      *list.List               //в начале - недавно использованные
+	inFlight map[string]*memoCall
+	stats    MemoStats
+}
+
+// MemoStats - счётчики кеша
+type MemoStats struct {
+	Hits   int // результат взят из кеша
+	Shared int // дождались расчёта, который уже шёл для того же значения
+	Misses int // вызвана настоящая функция
+}
+
+type memoEntry struct {
+	key, val string
+}
+
+type memoCall struct {
+	done     chan struct{}
+	val      string
+	panicked bool
+	reason   interface{} //с чем паниковала fn, ждущие паникуют с тем же
+}
+
+func newSignMemo(size int, fn func(string) string) *signMemo {
+	return &signMemo{
+		fn:       fn,
+		size:     size,
+		items:    map[string]*list.Element{},
+		lru:      list.New(),
+		inFlight: map[string]*memoCall{},
+	}
+}
+
+// Get возвращает fn(data), вызывая fn только если значения нет в кеше и его сейчас никто не считает.
+// Если fn паникует, паника достаётся и всем ждущим этот расчёт, а в кеш ничего не попадает
+func (m *signMemo) Get(data string) string {
+	m.mu.Lock()
+	if elem, ok := m.items[data]; ok {
+		m.lru.MoveToFront(elem)
+		m.stats.Hits++
+		m.mu.Unlock()
+		return elem.Value.(*memoEntry).val
+	}
+	if call, ok := m.inFlight[data]; ok {
+		m.stats.Shared++
+		m.mu.Unlock()
+		<-call.done
+		if call.panicked {
+			panic(call.reason)
+		}
+		return call.val
+	}
+	call := &memoCall{done: make(chan struct{})}
+	m.inFlight[data] = call
+	m.stats.Misses++
+	m.mu.Unlock()
+
+	call.panicked = true
+	defer func() {
+		if call.panicked {
+			call.reason = recover()
+			m.mu.Lock()
+			delete(m.inFlight, data)
+			m.mu.Unlock()
+			close(call.done)
+			if call.reason != nil { //nil - fn вызвала runtime.Goexit, не мешаем ей
+				panic(call.reason)
+			}
+		}
+	}()
+	call.val = m.fn(data)
+	call.panicked = false
+
+	m.mu.Lock()
+	delete(m.inFlight, data)
+	m.items[data] = m.lru.PushFront(&memoEntry{key: data, val: call.val})
+	if m.lru.Len() > m.size {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoEntry).key)
+	}
+	m.mu.Unlock()
+	close(call.done)
+	return call.val
+}
+
+// Stats возвращает счётчики кеша
+func (m *signMemo) Stats() MemoStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// signerCache - кеши для DataSignerCrc32 и DataSignerMd5
+type signerCache struct {
+	crc32 *signMemo
+	md5   *signMemo
+}
+
+// activeSignerCache - nil, пока кеш не включён
+var activeSignerCache atomic.Pointer[signerCache]
+
+// EnableSignerCache включает кеш на size значений для каждой из функций подписи.
+// На промахе вызываются настоящие DataSignerCrc32 и DataSignerMd5
+func EnableSignerCache(size int) {
+	activeSignerCache.Store(&signerCache{
+		crc32: newSignMemo(size, func(data string) string {
+			return DataSignerCrc32(data)
+		}),
+		md5: newSignMemo(size, signMd5),
+	})
+}
+
+// DisableSignerCache выключает кеш и забывает сохранённые значения
+func DisableSignerCache() {
+	activeSignerCache.Store(nil)
+}
+
+// SignerCacheStats возвращает счётчики кешей crc32 и md5, пока кеш включён
+func SignerCacheStats() (crc32Stats, md5Stats MemoStats) {
+	if cache := activeSignerCache.Load(); cache != nil {
+		return cache.crc32.Stats(), cache.md5.Stats()
+	}
+	return MemoStats{}, MemoStats{}
+}
+
+// callCrc32 вызывает DataSignerCrc32 через кеш, если он включён
+func callCrc32(data string) string {
+	if cache := activeSignerCache.Load(); cache != nil {
+		return cache.crc32.Get(data)
+	}
+	return DataSignerCrc32(data)
+}
+
+// callMd5 вызывает DataSignerMd5 через кеш, если он включён
+func callMd5(data string) string {
+	if cache := activeSignerCache.Load(); cache != nil {
+		return cache.md5.Get(data)
+	}
+	return signMd5(data)
+}
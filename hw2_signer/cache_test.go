@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignMemoLRU(t *testing.T) {
+	var calls int
+	m := newSignMemo(2, func(data string) string {
+		calls++
+		return data + "!"
+	})
+	for _, data := range []string{"a", "b", "a", "c", "a", "b"} { //c вытесняет b, потом b вытесняет c
+		if val := m.Get(data); val != data+"!" {
+			t.Errorf("unexpected value %v for %v", val, data)
+		}
+	}
+	stats := m.Stats()
+	if calls != 4 || stats.Misses != 4 || stats.Hits != 2 {
+		t.Errorf("expected 4 calls and 2 hits, got %d calls, %+v", calls, stats)
+	}
+}
+
+func TestSignMemoSingleFlight(t *testing.T) {
+	var calls int32
+	m := newSignMemo(10, func(data string) string {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return data
+	})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Get("x")
+		}()
+	}
+	wg.Wait()
+	stats := m.Stats()
+	if calls != 1 || stats.Misses != 1 || stats.Shared+stats.Hits != 9 {
+		t.Errorf("expected one call, got %d, %+v", calls, stats)
+	}
+}
+
+func TestSignMemoPanic(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	m := newSignMemo(10, func(data string) string {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			panic("boom")
+		}
+		return data
+	})
+	get := func() (val string, reason interface{}) {
+		defer func() { reason = recover() }()
+		return m.Get("x"), nil
+	}
+
+	reasons := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, reason := get()
+			reasons <- reason
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for m.Stats().Shared != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("second Get must wait for the first, got %+v", m.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if reason := <-reasons; reason != "boom" {
+			t.Errorf("expected panic boom in every Get, got %v", reason)
+		}
+	}
+
+	//после паники значение не закешировано и считается заново
+	if val, reason := get(); val != "x" || reason != nil || calls != 2 {
+		t.Errorf("expected recomputed x, got %q, %v after %d calls", val, reason, calls)
+	}
+}
+
+func TestSignerCache(t *testing.T) {
+	fastSigners(t)
+	var md5Counter, crc32Counter uint32
+	md5Fast, crc32Fast := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		atomic.AddUint32(&md5Counter, 1)
+		return md5Fast(data)
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(&crc32Counter, 1)
+		time.Sleep(10 * time.Millisecond) //повтор 1 приходит, пока первый ещё считается
+		return crc32Fast(data)
+	}
+	EnableSignerCache(100)
+	defer DisableSignerCache()
+
+	var result string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range []int{0, 1, 1, 2, 3, 5, 8} {
+				out <- fibNum
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	if result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+
+	// 6 разных значений: 2 crc32 в SingleHash и 6 в MultiHash на каждое
+	crc32Stats, md5Stats := SignerCacheStats()
+	if md5Counter != 6 || crc32Counter != 6*8 {
+		t.Errorf("expected 6 md5 and 48 crc32 calls, got %d and %d", md5Counter, crc32Counter)
+	}
+	if md5Stats.Misses != int(md5Counter) || crc32Stats.Misses != int(crc32Counter) {
+		t.Errorf("misses must match real calls: md5 %+v, crc32 %+v", md5Stats, crc32Stats)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunSignerCombined(t *testing.T) {
+	fastSigners(t)
+
+	inputs := []string{"0", "1", "1", "2", "3", "5", "8"}
+	for _, workers := range []int{1, 3, MaxInputDataLen} {
+		chain := defaultChain
+		chain.Workers = workers
+		out := &bytes.Buffer{}
+		if err := runSigner(context.Background(), signerConfig{chain: chain, format: "combined"}, inputs, out); err != nil {
+			t.Fatalf("workers %d: %v", workers, err)
+		}
+		if got := out.String(); got != testSignerExpected+"\n" {
+			t.Errorf("workers %d: got %q, expected %q", workers, got, testSignerExpected)
+		}
+	}
+}
+
+func TestRunSignerJSON(t *testing.T) {
+	fastSigners(t)
+
+	inputs := []string{"8", "5", "3", "2", "1", "0"}
+	out := &bytes.Buffer{}
+	if err := runSigner(context.Background(), signerConfig{chain: defaultChain, format: "json"}, inputs, out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(inputs) {
+		t.Fatalf("got %d lines, expected %d:\n%s", len(lines), len(inputs), out)
+	}
+	for i, line := range lines {
+		var got signedInput
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		expected := signedInput{inputs[i], defaultChain.multiHash(defaultChain.singleHash(inputs[i]))}
+		if got != expected {
+			t.Errorf("line %d: got %+v, expected %+v", i, got, expected)
+		}
+	}
+}
+
+func TestRunSignerUnknownFormat(t *testing.T) {
+	err := runSigner(context.Background(), signerConfig{chain: defaultChain, format: "xml"}, nil, &bytes.Buffer{})
+	if err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestReadInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inputs")
+	if err := os.WriteFile(path, []byte("0\n  1\n\n\nfoo bar \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readInputs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"0", "1", "foo bar"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if _, err := readInputs(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
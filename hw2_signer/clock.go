@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - время для функций из common.go. В тестах вместо настоящего ставится FakeClock,
+// тогда задержки DataSignerCrc32 и DataSignerMd5 идут в виртуальном времени
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// SignerClock - часы, по которым спят DataSignerMd5, DataSignerCrc32 и OverheatLock
+var SignerClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FakeClock - виртуальное время: Sleep ждёт, пока часы не переведут через Advance
+// или AutoAdvance, сам по себе он не заканчивается
+type FakeClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	sleepers []*sleeper
+	gen      uint64 //меняется при каждом засыпании и пробуждении, AutoAdvance так видит, что все спят
+}
+
+type sleeper struct {
+	until time.Time
+	wake  chan struct{}
+}
+
+// NewFakeClock создаёт часы, которые показывают start
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now - текущее виртуальное время
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep блокируется, пока виртуальное время не уйдёт на d вперёд
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s := &sleeper{wake: make(chan struct{})}
+	c.mu.Lock()
+	s.until = c.now.Add(d)
+	c.sleepers = append(c.sleepers, s)
+	c.gen++
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	<-s.wake
+}
+
+// Advance переводит часы на d вперёд и будит всех, чей срок подошёл
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+func (c *FakeClock) advanceTo(t time.Time) {
+	c.now = t
+	sleepers := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if s.until.After(t) {
+			sleepers = append(sleepers, s)
+		} else {
+			close(s.wake)
+		}
+	}
+	clear(c.sleepers[len(sleepers):])
+	c.sleepers = sleepers
+	c.gen++
+	c.cond.Broadcast()
+}
+
+// BlockUntil ждёт, пока в Sleep не окажутся n горутин
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.sleepers) < n {
+		c.cond.Wait()
+	}
+}
+
+// AutoAdvance в фоне переводит часы к ближайшему сроку, как только за settle настоящего времени
+// никто не заснул и не проснулся, т.е. все, кто работает по часам, спят.
+// Вернёт функцию, которая останавливает перевод
+func (c *FakeClock) AutoAdvance(settle time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			c.mu.Lock()
+			gen := c.gen
+			c.mu.Unlock()
+			select {
+			case <-time.After(settle):
+			case <-done:
+				return
+			}
+			c.mu.Lock()
+			if gen == c.gen && len(c.sleepers) > 0 {
+				next := c.sleepers[0].until
+				for _, s := range c.sleepers[1:] {
+					if s.until.Before(next) {
+						next = s.until
+					}
+				}
+				c.advanceTo(next)
+			}
+			c.mu.Unlock()
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
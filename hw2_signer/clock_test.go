@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSignerClock возвращает функциям из common.go их настоящий вид, но по виртуальным часам
+func fakeSignerClock(t *testing.T) *FakeClock {
+	clock := NewFakeClock(time.Unix(0, 0))
+	md5Orig, crc32Orig, lockOrig, unlockOrig, clockOrig := DataSignerMd5, DataSignerCrc32, OverheatLock, OverheatUnlock, SignerClock
+	t.Cleanup(func() {
+		DataSignerMd5, DataSignerCrc32, OverheatLock, OverheatUnlock, SignerClock = md5Orig, crc32Orig, lockOrig, unlockOrig, clockOrig
+	})
+	DataSignerMd5, DataSignerCrc32, OverheatLock, OverheatUnlock = dataSignerMd5, dataSignerCrc32, overheatLock, overheatUnlock
+	SignerClock = clock
+	return clock
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var woken atomic.Int32
+	for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+		go func(d time.Duration) {
+			clock.Sleep(d)
+			woken.Add(1)
+		}(d)
+	}
+	clock.BlockUntil(2)
+
+	clock.Advance(999 * time.Millisecond)
+	clock.BlockUntil(2)
+	if woken.Load() != 0 {
+		t.Fatalf("woke up too early")
+	}
+	clock.Advance(time.Millisecond)
+	clock.BlockUntil(1)
+	for woken.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	for woken.Load() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := clock.Now(); !got.Equal(time.Unix(2, 0)) {
+		t.Errorf("got time %v", got)
+	}
+}
+
+func TestSignerCriticalPath(t *testing.T) {
+	cases := []struct {
+		inputs   []int
+		expected time.Duration
+	}{
+		// md5 по очереди 2*10ms, потом crc32(md5) 1s, потом 6 crc32 MultiHash параллельно 1s
+		{[]int{0, 1}, 2020 * time.Millisecond},
+		{[]int{0, 1, 1, 2, 3, 5, 8}, 2070 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		clock := fakeSignerClock(t)
+		stop := clock.AutoAdvance(10 * time.Millisecond)
+
+		realStart, start := time.Now(), clock.Now()
+		result := signChain(defaultChain, tc.inputs)
+		elapsed, realElapsed := clock.Now().Sub(start), time.Since(realStart)
+		stop()
+
+		if elapsed != tc.expected {
+			t.Errorf("%v: critical path %v, expected %v", tc.inputs, elapsed, tc.expected)
+		}
+		if realElapsed > time.Second {
+			t.Errorf("%v: took %v of real time", tc.inputs, realElapsed)
+		}
+		if len(tc.inputs) == 7 && result != testSignerExpected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+		}
+	}
+}
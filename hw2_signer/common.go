@@ -20,41 +20,49 @@ var (
 	DataSignerSalt            = ""
 )
 
-var OverheatLock = func() {
+// по умолчанию функции ниже - dataSignerMd5, dataSignerCrc32 и т.д., их можно вернуть после подмены
+var (
+	OverheatLock    = overheatLock
+	OverheatUnlock  = overheatUnlock
+	DataSignerMd5   = dataSignerMd5
+	DataSignerCrc32 = dataSignerCrc32
+)
+
+func overheatLock() {
 	for {
 		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1); !swapped {
 			fmt.Println("OverheatLock happend")
-			time.Sleep(time.Second)
+			SignerClock.Sleep(time.Second)
 		} else {
 			break
 		}
 	}
 }
 
-var OverheatUnlock = func() {
+func overheatUnlock() {
 	for {
 		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 1, 0); !swapped {
 			fmt.Println("OverheatUnlock happend")
-			time.Sleep(time.Second)
+			SignerClock.Sleep(time.Second)
 		} else {
 			break
 		}
 	}
 }
 
-var DataSignerMd5 = func(data string) string {
+func dataSignerMd5(data string) string {
 	OverheatLock()
 	defer OverheatUnlock()
 	data += DataSignerSalt
 	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
-	time.Sleep(10 * time.Millisecond)
+	SignerClock.Sleep(10 * time.Millisecond)
 	return dataHash
 }
 
-var DataSignerCrc32 = func(data string) string {
+func dataSignerCrc32(data string) string {
 	data += DataSignerSalt
 	crcH := crc32.ChecksumIEEE([]byte(data))
 	dataHash := strconv.FormatUint(uint64(crcH), 10)
-	time.Sleep(time.Second)
+	SignerClock.Sleep(time.Second)
 	return dataHash
 }
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Graph - конвейер в виде графа. Стадия может читать из нескольких стадий сразу (merge),
+// несколько стадий могут читать из одной - каждая получит все её значения (tee),
+// Branch разводит значения по двум выходам по условию. Рёбра - буферизованные каналы на MaxInputDataLen
+type Graph struct {
+	nodes []*graphNode
+	ports map[string]graphPort //имя выхода -> узел и номер его выхода
+	errs  []error              //ошибки сборки, Validate и Run вернут их
+}
+
+type graphNode struct {
+	name  string
+	from  []string
+	outs  []string //имена выходов, у стадии - одно, её имя
+	job   jobCtx
+	route func(val interface{}) int //у Branch - в какой выход отправить значение
+}
+
+type graphPort struct {
+	node *graphNode
+	out  int
+}
+
+// NewGraph создаёт пустой граф
+func NewGraph() *Graph {
+	return &Graph{ports: map[string]graphPort{}}
+}
+
+// Stage добавляет стадию name, которая читает значения всех стадий из from вперемешку.
+// Без from стадия - источник, её вход сразу закрыт
+func (g *Graph) Stage(name string, job jobCtx, from ...string) *Graph {
+	if job == nil {
+		g.errs = append(g.errs, fmt.Errorf("graph: stage %q has nil job", name))
+		return g
+	}
+	g.add(&graphNode{name: name, from: from, outs: []string{name}, job: job})
+	return g
+}
+
+// Branch отправляет значения стадии from в ifTrue, если pred вернул true, иначе в ifFalse.
+// ifTrue и ifFalse дальше используются как имена стадий в from, пустое имя - значения выбрасываются
+func (g *Graph) Branch(from string, pred func(val interface{}) bool, ifTrue, ifFalse string) *Graph {
+	name := "branch(" + from + ")"
+	if pred == nil {
+		g.errs = append(g.errs, fmt.Errorf("graph: %s has nil predicate", name))
+		return g
+	}
+	g.add(&graphNode{
+		name: name,
+		from: []string{from},
+		outs: []string{ifTrue, ifFalse},
+		route: func(val interface{}) int {
+			if pred(val) {
+				return 0
+			}
+			return 1
+		},
+	})
+	return g
+}
+
+func (g *Graph) add(node *graphNode) {
+	for i, out := range node.outs {
+		if out == "" {
+			continue
+		}
+		if _, ok := g.ports[out]; ok {
+			g.errs = append(g.errs, fmt.Errorf("graph: duplicate stage %q", out))
+			continue
+		}
+		g.ports[out] = graphPort{node: node, out: i}
+	}
+	g.nodes = append(g.nodes, node)
+}
+
+// Validate проверяет, что граф собран правильно: все from существуют, нет повторов и циклов
+func (g *Graph) Validate() error {
+	errs := append([]error(nil), g.errs...)
+	if len(g.nodes) == 0 {
+		errs = append(errs, errors.New("graph: no stages"))
+	}
+	for _, node := range g.nodes {
+		seen := map[string]bool{}
+		for _, from := range node.from {
+			if _, ok := g.ports[from]; !ok {
+				errs = append(errs, fmt.Errorf("graph: stage %q reads from unknown stage %q", node.name, from))
+			}
+			if seen[from] {
+				errs = append(errs, fmt.Errorf("graph: stage %q reads from %q twice", node.name, from))
+			}
+			seen[from] = true
+		}
+	}
+	if cycle := g.findCycle(); cycle != nil {
+		errs = append(errs, fmt.Errorf("graph: cycle %s", strings.Join(cycle, " -> ")))
+	}
+	return errors.Join(errs...)
+}
+
+// findCycle ищет цикл обходом в глубину, возвращает его стадии, первая повторена в конце
+func (g *Graph) findCycle() []string {
+	const (
+		unvisited = iota
+		inPath
+		finished
+	)
+	state := map[*graphNode]int{}
+	var path []*graphNode
+	var visit func(node *graphNode) []string
+	visit = func(node *graphNode) []string {
+		state[node] = inPath
+		path = append(path, node)
+		for _, from := range node.from {
+			port, ok := g.ports[from]
+			if !ok {
+				continue
+			}
+			switch state[port.node] {
+			case inPath:
+				var cycle []string
+				for i := len(path) - 1; i >= 0; i-- { //рёбра идут от потребителя к источнику - разворачиваем
+					cycle = append(cycle, path[i].name)
+					if path[i] == port.node {
+						break
+					}
+				}
+				return append(cycle, cycle[0])
+			case unvisited:
+				if cycle := visit(port.node); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = finished
+		return nil
+	}
+	for _, node := range g.nodes {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// Run проверяет граф и запускает все стадии. Как в ExecutePipelineContext, первая ошибка
+// отменяет ctx всех стадий, каналы вычитываются до закрытия и ошибка возвращается в конце,
+// а dead letters от Retry возвращаются как *DeadLetterError
+func (g *Graph) Run(ctx context.Context) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &pipelineRun{cancel: cancel}
+	names := make([]string, len(g.nodes))
+	for i, node := range g.nodes {
+		names[i] = node.name
+	}
+	rec := newPipelineRecorder(names, nil)
+
+	// рёбра: на каждый выход - по каналу на каждого, кто из него читает
+	edges := map[graphPort][]chan interface{}{}
+	inputs := make([][]chan interface{}, len(g.nodes))
+	for i, node := range g.nodes {
+		for _, from := range node.from {
+			edge := make(chan interface{}, MaxInputDataLen)
+			edges[g.ports[from]] = append(edges[g.ports[from]], edge)
+			inputs[i] = append(inputs[i], edge)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for i, node := range g.nodes {
+		in := g.merge(ctx, wg, inputs[i])
+		outs := make([]chan interface{}, len(node.outs))
+		for j := range node.outs {
+			outs[j] = make(chan interface{})
+			wg.Add(1)
+			go tee(ctx, wg, rec, i, outs[j], edges[graphPort{node, j}])
+		}
+
+		job := node.job
+		if node.route != nil {
+			job = branchJob(node.route, outs)
+		}
+		wg.Add(1)
+		go startWorker(ctx, wg, run, rec, i, job, in, outs[0])
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			run.fail(ctx.Err())
+			<-done
+		case <-done:
+		}
+	}()
+	wg.Wait()
+	close(done)
+	<-stopped
+	return deadLetterErr(&PipelineResult{DeadLetters: rec.dead}, run.err)
+}
+
+// merge сводит рёбра в один вход стадии
+func (g *Graph) merge(ctx context.Context, wg *sync.WaitGroup, edges []chan interface{}) chan interface{} {
+	switch len(edges) {
+	case 0:
+		in := make(chan interface{}) //у источника нет входных данных
+		close(in)
+		return in
+	case 1:
+		return edges[0]
+	}
+	in := make(chan interface{})
+	mergeWg := &sync.WaitGroup{}
+	for _, edge := range edges {
+		mergeWg.Add(1)
+		go func(edge chan interface{}) {
+			defer mergeWg.Done()
+			for val := range edge {
+				select {
+				case in <- val:
+				case <-ctx.Done():
+				}
+			}
+		}(edge)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mergeWg.Wait()
+		close(in)
+	}()
+	return in
+}
+
+// tee отправляет каждое значение из out во все рёбра, без рёбер - выбрасывает.
+// DeadLetter дальше не идёт, а попадает в итог, как в ExecutePipeline
+func tee(ctx context.Context, wg *sync.WaitGroup, rec *pipelineRecorder, stage int, out chan interface{}, edges []chan interface{}) {
+	defer wg.Done()
+	defer func() {
+		for _, edge := range edges {
+			close(edge)
+		}
+	}()
+	for val := range out {
+		if dl, ok := val.(DeadLetter); ok {
+			rec.deadLetter(stage, dl)
+			continue
+		}
+		for _, edge := range edges {
+			select {
+			case edge <- val:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// branchJob отправляет значения в outs[route(val)], outs[0] закроет startWorker
+func branchJob(route func(val interface{}) int, outs []chan interface{}) jobCtx {
+	return func(ctx context.Context, in, _ chan interface{}) error {
+		defer func() {
+			for _, out := range outs[1:] {
+				close(out)
+			}
+		}()
+		for val := range in {
+			select {
+			case outs[route(val)] <- val:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ints - источник со значениями vals
+func ints(vals ...int) jobCtx {
+	return adaptJob(func(in, out chan interface{}) {
+		for _, val := range vals {
+			out <- val
+		}
+	})
+}
+
+// collect - сток, который складывает значения в *dst
+func collect(mu *sync.Mutex, dst *[]int) jobCtx {
+	return adaptJob(func(in, out chan interface{}) {
+		for val := range in {
+			mu.Lock()
+			*dst = append(*dst, val.(int))
+			mu.Unlock()
+		}
+	})
+}
+
+func TestGraphTeeMergeBranch(t *testing.T) {
+	mu := &sync.Mutex{}
+	var all, doubled, even, odd []int
+	double := adaptJob(func(in, out chan interface{}) {
+		for val := range in {
+			out <- val.(int) * 2
+		}
+	})
+	err := NewGraph().
+		Stage("a", ints(1, 2, 3)).
+		Stage("b", ints(10, 11)).
+		Stage("all", collect(mu, &all), "a", "b"). //merge
+		Stage("double", double, "a").              //tee: a читают all и double
+		Stage("doubled", collect(mu, &doubled), "double").
+		Branch("b", func(val interface{}) bool { return val.(int)%2 == 0 }, "even", "odd").
+		Stage("evens", collect(mu, &even), "even").
+		Stage("odds", collect(mu, &odd), "odd").
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(all)
+	sort.Ints(doubled)
+	for _, tc := range []struct {
+		name          string
+		got, expected []int
+	}{
+		{"all", all, []int{1, 2, 3, 10, 11}},
+		{"doubled", doubled, []int{2, 4, 6}},
+		{"even", even, []int{10}},
+		{"odd", odd, []int{11}},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.expected) {
+			t.Errorf("%s: got %v, expected %v", tc.name, tc.got, tc.expected)
+		}
+	}
+}
+
+func TestGraphSigner(t *testing.T) {
+	fastSigners(t)
+
+	// одна и та же SingleHash идёт и в подпись, и в отдельный список
+	var result string
+	mu := &sync.Mutex{}
+	var singles []string
+	err := NewGraph().
+		Stage("input", ints(0, 1, 1, 2, 3, 5, 8)).
+		Stage("single", adaptJob(SingleHash), "input").
+		Stage("multi", adaptJob(MultiHash), "single").
+		Stage("combine", adaptJob(CombineResults), "multi").
+		Stage("result", adaptJob(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}), "combine").
+		Stage("singles", adaptJob(func(in, out chan interface{}) {
+			for val := range in {
+				mu.Lock()
+				singles = append(singles, val.(string))
+				mu.Unlock()
+			}
+		}), "single").
+		Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+	if len(singles) != 7 {
+		t.Errorf("got %d SingleHash values, expected 7", len(singles))
+	}
+}
+
+func TestGraphMiswired(t *testing.T) {
+	nop := adaptJob(func(in, out chan interface{}) {})
+	cases := []struct {
+		graph    *Graph
+		expected []string
+	}{
+		{NewGraph(), []string{"graph: no stages"}},
+		{
+			NewGraph().Stage("a", nop).Stage("b", nop, "c"),
+			[]string{`graph: stage "b" reads from unknown stage "c"`},
+		},
+		{
+			NewGraph().Stage("a", nop).Stage("a", nop).Stage("b", nil),
+			[]string{`graph: duplicate stage "a"`, `graph: stage "b" has nil job`},
+		},
+		{
+			NewGraph().Stage("a", nop).Stage("b", nop, "a", "a"),
+			[]string{`graph: stage "b" reads from "a" twice`},
+		},
+		{
+			NewGraph().Stage("src", nop).Stage("a", nop, "src", "c").Stage("b", nop, "a").Stage("c", nop, "b"),
+			[]string{"graph: cycle b -> c -> a -> b"},
+		},
+		{
+			NewGraph().Stage("a", nop, "a"),
+			[]string{"graph: cycle a -> a"},
+		},
+		{
+			NewGraph().Stage("a", nop).Branch("a", func(interface{}) bool { return true }, "a", ""),
+			[]string{`graph: duplicate stage "a"`},
+		},
+	}
+	for i, tc := range cases {
+		err := tc.graph.Validate()
+		if err == nil {
+			t.Errorf("case %d: expected error", i)
+			continue
+		}
+		if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("case %d: got %q, expected %q", i, got, tc.expected)
+		}
+		if runErr := tc.graph.Run(context.Background()); runErr == nil || runErr.Error() != err.Error() {
+			t.Errorf("case %d: Run returned %v", i, runErr)
+		}
+	}
+}
+
+func TestGraphErrorCancels(t *testing.T) {
+	errStage := errors.New("stage failed")
+	infinite := func(ctx context.Context, in, out chan interface{}) error {
+		for i := 0; ; i++ {
+			select {
+			case out <- i:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	start := time.Now()
+	err := NewGraph().
+		Stage("src", infinite).
+		Stage("fail", func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				if val.(int) == 3 {
+					return errStage
+				}
+			}
+			return nil
+		}, "src").
+		Stage("legacy", adaptJob(func(in, out chan interface{}) { //не смотрит на ctx, дочитывает до конца
+			for val := range in {
+				out <- val
+			}
+		}), "src").
+		Branch("legacy", func(interface{}) bool { return true }, "left", "right").
+		Run(context.Background())
+	if err != errStage {
+		t.Errorf("expected first error %v, got %v", errStage, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("graph was not cancelled")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Journal - журнал готовых значений на диске, в него только дописывают.
+// Первая строка - заголовок с отпечатком цепочки (HashChain.Fingerprint), остальные - JSON
+// как у signer -format json: вход и его MultiHash.
+// После падения конвейер с тем же журналом не пересчитывает то, что уже в нём есть
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]string
+}
+
+// ErrJournalMismatch - журнал записан другой цепочкой: с другой солью, ключом или функциями подписи
+var ErrJournalMismatch = errors.New("journal written by another chain")
+
+// journalHeader - первая строка журнала
+type journalHeader struct {
+	Chain string `json:"chain"`
+}
+
+// OpenJournal открывает журнал цепочки с отпечатком fingerprint, создавая файл, если его нет.
+// Журнал другой цепочки не открывается - ErrJournalMismatch. Недописанная при падении
+// последняя строка отбрасывается
+func OpenJournal(path, fingerprint string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{file: file, done: map[string]string{}}
+	size, err := j.load(fingerprint)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err == nil && size == 0 { //новый журнал, или не дописан даже заголовок
+		err = j.writeLine(journalHeader{Chain: fingerprint})
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// load проверяет заголовок, читает записи и возвращает длину целой части файла
+func (j *Journal) load(fingerprint string) (int64, error) {
+	reader := bufio.NewReader(j.file)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil //без \n - запись не дописана
+		}
+		if err != nil {
+			return 0, err
+		}
+		if size == 0 {
+			var header journalHeader
+			if err := json.Unmarshal(bytes.TrimSpace(line), &header); err != nil || header.Chain != fingerprint {
+				return 0, ErrJournalMismatch
+			}
+			size += int64(len(line))
+			continue
+		}
+		var rec signedInput
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return 0, fmt.Errorf("bad record at offset %d: %w", size, err)
+		}
+		j.done[rec.Input] = rec.Signature
+		size += int64(len(line))
+	}
+}
+
+// Lookup возвращает MultiHash входа, если он уже есть в журнале
+func (j *Journal) Lookup(input string) (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	part, ok := j.done[input]
+	return part, ok
+}
+
+// Len - сколько входов в журнале
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.done)
+}
+
+// Record дописывает MultiHash входа в журнал и сбрасывает его на диск
+func (j *Journal) Record(input, part string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.done[input]; ok {
+		return nil
+	}
+	if err := j.writeLine(signedInput{Input: input, Signature: part}); err != nil {
+		return err
+	}
+	j.done[input] = part
+	return nil
+}
+
+// writeLine дописывает rec строкой JSON и сбрасывает файл на диск
+func (j *Journal) writeLine(rec interface{}) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil { //одной записью, чтобы строка не разорвалась
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Close закрывает файл журнала
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// journalProbe - вход, подписи которого дают отпечаток цепочки из безымянных функций подписи
+const journalProbe = "journal"
+
+// Fingerprint - отпечаток цепочки для журнала: sha256 от имён функций подписи, соли и хеша ключа.
+// Другие соль, ключ или функции подписи дают другой отпечаток, Workers и Ordered на него не влияют.
+// Если Outer или Inner - безымянная SignerFunc, отпечаток считается по их подписям пробного входа
+func (c HashChain) Fingerprint() string {
+	outer, inner := describeSigner(c.Outer), describeSigner(c.Inner)
+	desc := "config:" + outer + "~" + inner
+	if outer == "" || inner == "" {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			outer = c.Outer.Sign(journalProbe) //DataSignerCrc32 долгий - считаем вместе с Inner
+		}()
+		inner = c.Inner.Sign(journalProbe)
+		<-done
+		desc = "probe:" + outer + "~" + inner
+	}
+	sum := sha256.Sum256([]byte(desc))
+	return hex.EncodeToString(sum[:])
+}
+
+// signStages - стадии от входа до MultiHash: SingleHash и MultiHash, а с журналом - Checkpointed
+func (c HashChain) signStages(journal *Journal) []jobCtx {
+	if journal != nil {
+		return []jobCtx{c.CheckpointedStage(journal).Job()}
+	}
+	return []jobCtx{c.SingleHashStage().Job(), c.MultiHashStage().Job()}
+}
+
+// Checkpointed - job, который заменяет SingleHash и MultiHash: считает MultiHash(SingleHash) каждого входа,
+// записывая результат в журнал, а входы, которые уже есть в журнале, берёт из него.
+// Результаты уходят дальше по готовности (с Ordered - в порядке входа), CombineResults после него даёт ту же подпись
+func (c HashChain) Checkpointed(journal *Journal) job {
+	return func(in, out chan interface{}) {
+		runAsJob(c.CheckpointedStage(journal), in, out)
+	}
+}
+
+// CheckpointedStage - Checkpointed как типизированная стадия
+func (c HashChain) CheckpointedStage(journal *Journal) Stage[interface{}, string] {
+	fn := func(ctx context.Context, idata interface{}) (string, error) {
+		data := fmt.Sprintf("%v", idata)
+		if part, ok := journal.Lookup(data); ok {
+			return part, nil
+		}
+		part := c.multiHash(c.singleHash(data))
+		return part, journal.Record(data, part)
+	}
+	if c.Ordered {
+		return ParallelOrdered(c.workers(multiHashWorkers), fn)
+	}
+	return Parallel(c.workers(multiHashWorkers), fn)
+}
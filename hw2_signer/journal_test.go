@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// signJournal считает подпись inputs через Checkpointed с журналом
+func signJournal(chain HashChain, journal *Journal, inputs []int) (string, error) {
+	var result string
+	err := ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, val := range inputs {
+				out <- val
+			}
+		}),
+		chain.Checkpointed(journal),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				result = val.(string)
+			}
+		}),
+	)
+	return result, err
+}
+
+func TestJournalResume(t *testing.T) {
+	fastSigners(t)
+	path := filepath.Join(t.TempDir(), "journal")
+	inputs := []int{0, 1, 1, 2, 3, 5, 8}
+
+	// первый запуск падает на 8, по одному значению за раз - всё до него уже в журнале
+	journal, err := OpenJournal(path, defaultChain.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashing := defaultChain
+	crashing.Workers = 1
+	crashing.Inner = SignerFunc(func(data string) string {
+		if data == "8" {
+			panic("crash")
+		}
+		return callMd5(data)
+	})
+	if _, err := signJournal(crashing, journal, inputs); err == nil {
+		t.Fatalf("expected crash")
+	}
+	if journal.Len() != 5 {
+		t.Fatalf("journal has %d inputs, expected 5", journal.Len())
+	}
+	journal.Close()
+
+	// запись, оборванная на середине
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"input":"8","signa`)
+	file.Close()
+
+	journal, err = OpenJournal(path, defaultChain.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	var calls int32
+	counting := defaultChain
+	counting.Outer = SignerFunc(func(data string) string {
+		atomic.AddInt32(&calls, 1)
+		return callCrc32(data)
+	})
+	result, err := signJournal(counting, journal, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+	if calls != 8 { //2 на SingleHash и 6 на MultiHash, только для 8
+		t.Errorf("crc32 called %d times after resume, expected 8", calls)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 7 || lines[0] != `{"chain":"`+defaultChain.Fingerprint()+`"}` ||
+		!strings.HasPrefix(lines[6], `{"input":"8","signature":"`) {
+		t.Errorf("unexpected journal:\n%s", data)
+	}
+}
+
+func TestJournalBadRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	os.WriteFile(path, []byte("{\"chain\":\"x\"}\n{\"input\":\"0\",\"signature\":\"1\"}\nnot json\n"), 0o644)
+	if _, err := OpenJournal(path, "x"); err == nil || !strings.Contains(err.Error(), "offset 44") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestJournalChainMismatch(t *testing.T) {
+	fastSigners(t)
+	path := filepath.Join(t.TempDir(), "journal")
+	journal, err := OpenJournal(path, defaultChain.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Record("0", "part")
+	journal.Close()
+
+	sha256Chain, err := NewHashChain("crc32", "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := map[string]HashChain{
+		"salt":      defaultChain.WithSalt("s"),
+		"key":       defaultChain.WithKey([]byte("k")),
+		"signers":   sha256Chain,
+		"anonymous": {Outer: SignerFunc(callCrc32), Inner: SignerFunc(callCrc32)},
+	}
+	for name, chain := range chains {
+		if _, err := OpenJournal(path, chain.Fingerprint()); !errors.Is(err, ErrJournalMismatch) {
+			t.Errorf("%s: expected ErrJournalMismatch, got %v", name, err)
+		}
+	}
+
+	//журнал без заголовка, как до отпечатков, тоже чужой
+	os.WriteFile(path, []byte("{\"input\":\"0\",\"signature\":\"1\"}\n"), 0o644)
+	if _, err := OpenJournal(path, defaultChain.Fingerprint()); !errors.Is(err, ErrJournalMismatch) {
+		t.Errorf("expected ErrJournalMismatch for journal without header, got %v", err)
+	}
+
+	ordered := defaultChain
+	ordered.Workers, ordered.Ordered = 1, true
+	if ordered.Fingerprint() != defaultChain.Fingerprint() {
+		t.Errorf("Workers and Ordered must not change the fingerprint")
+	}
+}
+
+func TestChainFingerprint(t *testing.T) {
+	var calls int32
+	counting := func(data string) string {
+		atomic.AddInt32(&calls, 1)
+		return data
+	}
+	registerTestSigner(t, "counting", SignerFunc(counting))
+	chain, err := NewHashChain("counting", "counting")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//у цепочки из реестра отпечаток - по настройкам, подписи не считаются
+	keyed := chain.WithSalt("s").WithKey([]byte("k"))
+	if keyed.Fingerprint() != chain.WithSalt("s").WithKey([]byte("k")).Fingerprint() {
+		t.Errorf("same configuration must give the same fingerprint")
+	}
+	if keyed.Fingerprint() == chain.WithSalt("s").WithKey([]byte("other")).Fingerprint() {
+		t.Errorf("another key must give another fingerprint")
+	}
+	if calls != 0 {
+		t.Errorf("configured chain must not be signed for the fingerprint, %d calls", calls)
+	}
+
+	//безымянные функции подписи различаются по подписи пробного входа
+	anonymous := HashChain{Outer: SignerFunc(counting), Inner: SignerFunc(strings.ToUpper)}
+	if anonymous.Fingerprint() == (HashChain{Outer: SignerFunc(counting), Inner: SignerFunc(counting)}).Fingerprint() {
+		t.Errorf("different anonymous signers must give different fingerprints")
+	}
+	if calls == 0 {
+		t.Errorf("anonymous chain must fall back to the probe")
+	}
+}
+
+func TestRunSignerJournal(t *testing.T) {
+	fastSigners(t)
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal"), defaultChain.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	inputs := []string{"0", "1", "1", "2", "3", "5", "8"}
+	plain := &bytes.Buffer{}
+	if err := runSigner(context.Background(), signerConfig{chain: defaultChain, format: "json"}, inputs, plain); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		out := &bytes.Buffer{}
+		err := runSigner(context.Background(), signerConfig{chain: defaultChain, format: "combined", journal: journal}, inputs, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != testSignerExpected+"\n" {
+			t.Errorf("run %d: got %q", run, got)
+		}
+
+		out.Reset()
+		err = runSigner(context.Background(), signerConfig{chain: defaultChain, format: "json", journal: journal}, inputs, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != plain.String() {
+			t.Errorf("run %d: json with journal differs:\n%s\nexpected:\n%s", run, out, plain)
+		}
+	}
+	if journal.Len() != 6 {
+		t.Errorf("journal has %d inputs, expected 6", journal.Len())
+	}
+}
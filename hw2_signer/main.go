@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// signerConfig - настройки команды signer
+type signerConfig struct {
+	chain   HashChain
+	format  string   //combined или json
+	journal *Journal //готовые значения не пересчитываются, nil - без журнала
+
+	drain        <-chan struct{} //когда закрыт - новые значения не берутся, выводится результат по уже взятым
+	drainTimeout time.Duration
+}
+
+const usage = `usage: signer [flags] [value ...]
+
+Считает SingleHash -> MultiHash -> CombineResults для значений из аргументов,
+файла (-file) или stdin, по одному значению на строку.
+С -verify проверяет готовую подпись и показывает, какой вход с ней не сходится.
+По SIGINT или SIGTERM новые значения не берутся, уже взятые досчитываются (не дольше
+-drain-timeout) и выводится подпись по ним. Второй сигнал - выход сразу.
+
+`
+
+func main() {
+	flags := flag.NewFlagSet("signer", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	salt := flags.String("salt", "", "соль, которая добавляется к данным перед подписью")
+	key := flags.String("key", "", "ключ HMAC, если задан - каждая функция подписи считается как HMAC")
+	format := flags.String("format", "combined", "combined - одна строка CombineResults, json - по строке на каждое значение")
+	parallel := flags.Int("parallel", MaxInputDataLen, "сколько значений считается одновременно")
+	file := flags.String("file", "", "файл со значениями, - для stdin")
+	outer := flags.String("outer", "crc32", "внешняя функция подписи: "+strings.Join(SignerNames(), ", "))
+	inner := flags.String("inner", "md5", "внутренняя функция подписи")
+	verify := flags.String("verify", "", "проверить подпись вместо того, чтобы считать её")
+	journalPath := flags.String("journal", "", "журнал готовых значений: после падения повторный запуск их не пересчитывает")
+	drainTimeout := flags.Duration("drain-timeout", 5*time.Second, "сколько досчитывать уже взятые значения после SIGINT или SIGTERM")
+	flags.Parse(os.Args[1:])
+
+	chain, err := NewHashChain(*outer, *inner)
+	if err != nil {
+		fatal(err)
+	}
+	chain = chain.WithSalt(*salt)
+	if *key != "" {
+		chain = chain.WithKey([]byte(*key))
+	}
+	chain.Workers = *parallel
+
+	inputs := flags.Args()
+	if len(inputs) == 0 || *file != "" {
+		if inputs, err = readInputs(*file); err != nil {
+			fatal(err)
+		}
+	}
+
+	if *verify != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM) //частичная проверка не нужна
+		defer stop()
+		ok, err := runVerify(ctx, chain, inputs, *verify, os.Stdout)
+		if err != nil {
+			fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, drain, stopSignals := NotifyDrain(context.Background())
+	defer stopSignals()
+	cfg := signerConfig{chain: chain, format: *format, drain: drain, drainTimeout: *drainTimeout}
+	if *journalPath != "" {
+		if cfg.journal, err = OpenJournal(*journalPath, chain.Fingerprint()); err != nil {
+			fatal(err)
+		}
+	}
+	err = runSigner(ctx, cfg, inputs, os.Stdout)
+	if cfg.journal != nil {
+		cfg.journal.Close() //всё уже на диске, ошибка закрытия ничего не меняет
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "signer:", err)
+	os.Exit(1)
+}
+
+// readInputs читает значения по одному на строку из файла или stdin, пустые строки пропускаются
+func readInputs(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	var inputs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs, scanner.Err()
+}
+
+// signedInput - строка вывода -format json и запись Journal
+type signedInput struct {
+	Input     string `json:"input"`
+	Signature string `json:"signature"`
+}
+
+// runSigner прогоняет inputs через конвейер и пишет результат в out.
+// Если конвейер остановили через cfg.drain, в out - результат по части входа, и вернётся ошибка
+func runSigner(ctx context.Context, cfg signerConfig, inputs []string, out io.Writer) error {
+	opts := PipelineOptions{Drain: cfg.drain, DrainTimeout: cfg.drainTimeout}
+	interrupted := func(signed int) error {
+		return fmt.Errorf("interrupted: signed %d of %d inputs", signed, len(inputs))
+	}
+	switch cfg.format {
+	case "combined":
+		jobs := append([]jobCtx{sourceJob(inputs)}, cfg.chain.signStages(cfg.journal)...)
+		var result string
+		jobs = append(jobs,
+			adaptJob(CombineResults),
+			adaptJob(func(in, out chan interface{}) {
+				for val := range in {
+					result = val.(string)
+				}
+			}),
+		)
+		res, err := ExecutePipelineOpts(ctx, opts, jobs...)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintln(out, result); err != nil {
+			return err
+		}
+		signed := 0
+		if result != "" {
+			signed = strings.Count(result, "_") + 1
+		}
+		if res.Drained && signed < len(inputs) {
+			return interrupted(signed)
+		}
+		return nil
+
+	case "json":
+		enc := json.NewEncoder(out)
+		signed := 0
+		res, err := cfg.chain.signEach(ctx, opts, inputs, cfg.journal, func(i int, part string) error {
+			signed++
+			return enc.Encode(signedInput{Input: inputs[i], Signature: part})
+		})
+		if err == nil && res.Drained && signed < len(inputs) {
+			return interrupted(signed)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown format %q", cfg.format)
+}
+
+// runVerify проверяет signature по inputs и пишет в out, какой части подписи соответствует каждый вход
+func runVerify(ctx context.Context, chain HashChain, inputs []string, signature string, out io.Writer) (bool, error) {
+	report, err := chain.Verify(ctx, inputs, signature)
+	if err != nil {
+		return false, err
+	}
+	for i, item := range report.Items {
+		if item.Index < 0 {
+			fmt.Fprintf(out, "FAIL input %d %q: part %s not in signature\n", i, item.Input, item.Part)
+		} else {
+			fmt.Fprintf(out, "ok   input %d %q: part %d\n", i, item.Input, item.Index)
+		}
+	}
+	for _, idx := range report.Extra {
+		fmt.Fprintf(out, "FAIL part %d %s: no matching input\n", idx, report.Parts[idx])
+	}
+	if verr := report.Err(); verr != nil {
+		_, err = fmt.Fprintln(out, verr)
+		return false, err
+	}
+	_, err = fmt.Fprintln(out, "signature ok")
+	return true, err
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StageMetrics - счётчики одной стадии конвейера
+type StageMetrics struct {
+	Name        string
+	In          int           // сколько значений стадия забрала из входа
+	Out         int           // сколько значений стадия отправила дальше
+	Latency     LatencyStats  // обработка одного значения, см. LatencyStats
+	Blocked     int           // сколько отправок ждали места в очереди следующей стадии
+	BlockedTime time.Duration // сколько всего стадия простояла на отправке
+	MaxQueue    int           // максимальная длина очереди после стадии
+	QueueDepth  []DepthSample // длина очереди после стадии во времени, если задан SampleInterval
+	Started     time.Duration // запуск стадии от начала конвейера
+	Finished    time.Duration // завершение стадии от начала конвейера
+}
+
+// LatencyStats - задержка стадии на значение. Parallel и ParallelOrdered замеряют каждое значение сами,
+// у остальных стадий входы и выходы сопоставляются по порядку, и для стадий, которые меняют
+// порядок или число значений, это оценка
+type LatencyStats struct {
+	Count int
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Avg - средняя задержка
+func (l LatencyStats) Avg() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+// DepthSample - длина очереди в момент At от начала конвейера
+type DepthSample struct {
+	At    time.Duration
+	Depth int
+}
+
+// PipelineResult - итог ExecutePipelineOpts
+type PipelineResult struct {
+	Stages      []StageMetrics
+	DeadLetters []DeadLetter // значения, которые Retry не смог обработать
+	Drained     bool         // конвейер остановили через PipelineOptions.Drain, результат - по части входа
+}
+
+// pipelineRecorder собирает метрики стадий одного запуска, методы вызываются из разных горутин
+type pipelineRecorder struct {
+	mu       sync.Mutex
+	start    time.Time
+	names    []string
+	stages   []StageMetrics
+	inTimes  [][]time.Time //когда стадия забрала значения, ещё не сопоставленные с выходом
+	measured []bool        //стадия сама сообщает задержку каждого значения через item
+	seq      []int         //номера значений для событий трассировки
+	trace    *Tracer
+	dead     []DeadLetter
+}
+
+func newPipelineRecorder(names []string, trace *Tracer) *pipelineRecorder {
+	r := &pipelineRecorder{
+		start:    time.Now(),
+		names:    names,
+		stages:   make([]StageMetrics, len(names)),
+		inTimes:  make([][]time.Time, len(names)),
+		measured: make([]bool, len(names)),
+		seq:      make([]int, len(names)),
+		trace:    trace,
+	}
+	for i, name := range names {
+		r.stages[i].Name = name
+		trace.threadName(i, name)
+	}
+	return r
+}
+
+func (r *pipelineRecorder) stageStarted(stage int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages[stage].Started = time.Since(r.start)
+}
+
+func (r *pipelineRecorder) stageFinished(stage int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &r.stages[stage]
+	m.Finished = time.Since(r.start)
+	r.trace.complete(stage, m.Name, r.start.Add(m.Started), m.Finished-m.Started)
+}
+
+// in - стадия забрала значение из входа
+func (r *pipelineRecorder) in(stage int) {
+	if stage >= len(r.stages) { //выход последней стадии никто не читает
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages[stage].In++
+	if !r.measured[stage] {
+		r.inTimes[stage] = append(r.inTimes[stage], now)
+	}
+}
+
+// out - стадия отправила значение, в очереди после неё теперь depth значений
+func (r *pipelineRecorder) out(stage int, depth int) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &r.stages[stage]
+	m.Out++
+	if depth > m.MaxQueue {
+		m.MaxQueue = depth
+	}
+	if r.measured[stage] || len(r.inTimes[stage]) == 0 {
+		return
+	}
+	r.latency(stage, r.inTimes[stage][0], now)
+	r.inTimes[stage] = r.inTimes[stage][1:]
+}
+
+// measureItems - стадия дальше сама сообщает задержку каждого значения, входы с выходами не сопоставляются
+func (r *pipelineRecorder) measureItems(stage int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.measured[stage] = true
+	r.inTimes[stage] = nil
+}
+
+// item - стадия обработала одно значение с start до end
+func (r *pipelineRecorder) item(stage int, start, end time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency(stage, start, end)
+}
+
+// latency записывает обработку одного значения, r.mu уже взят
+func (r *pipelineRecorder) latency(stage int, start, end time.Time) {
+	m := &r.stages[stage]
+	d := end.Sub(start)
+	m.Latency.Count++
+	m.Latency.Total += d
+	if d > m.Latency.Max {
+		m.Latency.Max = d
+	}
+	r.trace.asyncBegin(stage, m.Name, r.seq[stage], start)
+	r.trace.asyncEnd(stage, m.Name, r.seq[stage], end)
+	r.seq[stage]++
+}
+
+// itemRecorder - метрики одной стадии для Parallel и ParallelOrdered внутри неё, методы можно вызывать у nil
+type itemRecorder struct {
+	rec   *pipelineRecorder
+	stage int
+}
+
+type itemRecorderKey struct{}
+
+// jobItems - itemRecorder по входу стадии, для стадий внутри старого job, которому ctx не передать
+var jobItems sync.Map
+
+// stageItems достаёт из ctx метрики стадии и убирает их, чтобы вложенные стадии не писали туда же
+func stageItems(ctx context.Context) (*itemRecorder, context.Context) {
+	items, _ := ctx.Value(itemRecorderKey{}).(*itemRecorder)
+	if items == nil {
+		return nil, ctx
+	}
+	return items, context.WithValue(ctx, itemRecorderKey{}, (*itemRecorder)(nil))
+}
+
+// jobContext - ctx для стадии внутри старого job: метрики стадии находятся по её входу
+func jobContext(in chan interface{}) context.Context {
+	ctx := context.Background()
+	if items, ok := jobItems.Load(in); ok {
+		ctx = context.WithValue(ctx, itemRecorderKey{}, items)
+	}
+	return ctx
+}
+
+func (ir *itemRecorder) measure() {
+	if ir != nil {
+		ir.rec.measureItems(ir.stage)
+	}
+}
+
+// done - значение, которое начали обрабатывать в start, обработано
+func (ir *itemRecorder) done(start time.Time) {
+	if ir != nil {
+		ir.rec.item(ir.stage, start, time.Now())
+	}
+}
+
+// deadLetter - стадия отправила DeadLetter, дальше по конвейеру он не идёт
+func (r *pipelineRecorder) deadLetter(stage int, dl DeadLetter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if dl.Stage == "" {
+		dl.Stage = r.names[stage]
+	}
+	r.dead = append(r.dead, dl)
+}
+
+func (r *pipelineRecorder) blocked(stage int, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages[stage].Blocked++
+	r.stages[stage].BlockedTime += d
+}
+
+// sample запоминает текущую длину очередей
+func (r *pipelineRecorder) sample(queues []*stageQueue) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, q := range queues {
+		depth := int(q.depth.Load())
+		r.stages[i].QueueDepth = append(r.stages[i].QueueDepth, DepthSample{At: now.Sub(r.start), Depth: depth})
+		r.trace.counter(i, "queue "+r.stages[i].Name, depth, now)
+	}
+}
+
+// stageQueue - очередь между стадией и следующей за ней. Стадия пишет в from без буфера,
+// поэтому очередь видит каждое значение и знает, когда стадия упирается в заполненный буфер
+type stageQueue struct {
+	stage    int //номер стадии, которая пишет в очередь
+	from, to chan interface{}
+	capacity int //меньше нуля - без ограничения
+	depth    atomic.Int64
+	rec      *pipelineRecorder
+	stop     <-chan struct{} //когда закрыт, очередь выбрасывает то, что в ней, и закрывает to
+}
+
+func (q *stageQueue) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	from := q.from
+	var queue []interface{}
+	var fullSince time.Time
+	for from != nil || len(queue) > 0 {
+		var recvCh, sendCh chan interface{} //nil-канал в select никогда не сработает
+		var head interface{}
+		if from != nil {
+			if q.capacity < 0 || len(queue) < q.capacity {
+				recvCh = from
+			} else if fullSince.IsZero() {
+				fullSince = time.Now()
+			}
+		}
+		if len(queue) > 0 {
+			sendCh, head = q.to, queue[0]
+		}
+
+		select {
+		case val, ok := <-recvCh:
+			if !ok {
+				from = nil
+				continue
+			}
+			queue = q.push(queue, val)
+		case sendCh <- head:
+			queue[0] = nil
+			queue = queue[1:]
+			q.rec.in(q.stage + 1)
+			if !fullSince.IsZero() {
+				// место освободилось - если стадия уже стоит на отправке, то стоит с момента заполнения
+				select {
+				case val, ok := <-from:
+					if !ok {
+						from = nil
+						break
+					}
+					q.rec.blocked(q.stage, time.Since(fullSince))
+					queue = q.push(queue, val)
+				default:
+				}
+				fullSince = time.Time{}
+			}
+		case <-q.stop:
+			close(q.to) //следующая стадия видит конец входа
+			q.depth.Store(0)
+			if from != nil {
+				drain(from) //стадия не должна встать на отправке
+			}
+			return
+		}
+		q.depth.Store(int64(len(queue)))
+	}
+	close(q.to)
+}
+
+// push ставит значение стадии в очередь, DeadLetter вместо этого уходит в итог конвейера
+func (q *stageQueue) push(queue []interface{}, val interface{}) []interface{} {
+	if dl, ok := val.(DeadLetter); ok {
+		q.rec.deadLetter(q.stage, dl)
+		return queue
+	}
+	queue = append(queue, val)
+	q.rec.out(q.stage, len(queue))
+	return queue
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+const backpressureItems = 100000
+
+// backpressureJobs - быстрый источник на backpressureItems значений и медленный приёмник
+func backpressureJobs(recieved *int) []jobCtx {
+	return []jobCtx{
+		adaptJob(func(in, out chan interface{}) {
+			for i := 0; i < backpressureItems; i++ {
+				out <- i
+			}
+		}),
+		adaptJob(func(in, out chan interface{}) {
+			for val := range in {
+				out <- val.(int) + 1
+			}
+		}),
+		adaptJob(func(in, out chan interface{}) {
+			time.Sleep(10 * time.Millisecond) //источник успевает уйти вперёд
+			for range in {
+				*recieved++
+				if *recieved%10000 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}),
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	var recieved int
+	result, err := ExecutePipelineOpts(context.Background(), PipelineOptions{}, backpressureJobs(&recieved)...)
+	if err != nil || recieved != backpressureItems {
+		t.Fatalf("unexpected result: err %v, recieved %d", err, recieved)
+	}
+	for i, m := range result.Stages[:2] {
+		if m.Out != backpressureItems {
+			t.Errorf("stage %d: expected %d values out, got %d", i, backpressureItems, m.Out)
+		}
+	}
+	if result.Stages[1].Blocked == 0 || result.Stages[1].BlockedTime == 0 {
+		t.Errorf("stage before the slow one must be blocked: %+v", result.Stages[1])
+	}
+}
+
+func TestPipelineStageBuffers(t *testing.T) {
+	var recieved int
+	opts := PipelineOptions{Buffer: 10, StageBuffers: map[int]int{1: backpressureItems}}
+	result, err := ExecutePipelineOpts(context.Background(), opts, backpressureJobs(&recieved)...)
+	if err != nil || recieved != backpressureItems {
+		t.Fatalf("unexpected result: err %v, recieved %d", err, recieved)
+	}
+	if result.Stages[1].Blocked != 0 {
+		t.Errorf("buffer fits all values, stage must not block: %+v", result.Stages[1])
+	}
+}
+
+func TestPipelineUnbounded(t *testing.T) {
+	var recieved int
+	result, err := ExecutePipelineOpts(context.Background(), PipelineOptions{Unbounded: true}, backpressureJobs(&recieved)...)
+	if err != nil || recieved != backpressureItems {
+		t.Fatalf("unexpected result: err %v, recieved %d", err, recieved)
+	}
+	for i, m := range result.Stages[:2] {
+		if m.Blocked != 0 || m.Out != backpressureItems {
+			t.Errorf("stage %d: unexpected metrics %+v", i, m)
+		}
+	}
+	if result.Stages[1].MaxQueue <= MaxInputDataLen {
+		t.Errorf("expected queue longer than %d, got %d", MaxInputDataLen, result.Stages[1].MaxQueue)
+	}
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	opts := PipelineOptions{StageNames: []string{"source", "slow"}, SampleInterval: time.Millisecond}
+	result, err := ExecutePipelineOpts(context.Background(), opts,
+		adaptJob(func(in, out chan interface{}) {
+			for i := 0; i < 10; i++ {
+				out <- i
+			}
+		}),
+		adaptJob(func(in, out chan interface{}) {
+			for val := range in {
+				time.Sleep(5 * time.Millisecond)
+				out <- val
+			}
+		}),
+		adaptJob(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source, slow, sink := result.Stages[0], result.Stages[1], result.Stages[2]
+	if source.Name != "source" || slow.Name != "slow" || sink.Name != "stage2" {
+		t.Errorf("unexpected names %v, %v, %v", source.Name, slow.Name, sink.Name)
+	}
+	if source.In != 0 || source.Out != 10 || slow.In != 10 || slow.Out != 10 || sink.In != 10 || sink.Out != 0 {
+		t.Errorf("unexpected counters: %+v", result.Stages)
+	}
+	if slow.Latency.Count != 10 || slow.Latency.Avg() < 5*time.Millisecond || slow.Latency.Max < slow.Latency.Avg() {
+		t.Errorf("unexpected latency %+v", slow.Latency)
+	}
+	if len(source.QueueDepth) == 0 || source.MaxQueue == 0 {
+		t.Errorf("source queue must be sampled: %+v", source)
+	}
+	if slow.Finished < 50*time.Millisecond || slow.Started > slow.Finished {
+		t.Errorf("unexpected stage times %v - %v", slow.Started, slow.Finished)
+	}
+}
+
+// traceFile - то, что пишет Tracer.WriteJSON
+type traceFile struct {
+	TraceEvents []traceEvent `json:"traceEvents"`
+}
+
+// maxParallel - сколько значений стадия обрабатывала одновременно по событиям трассировки
+func maxParallel(events []traceEvent, tid int) int {
+	var open, max int
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Ts < events[j].Ts })
+	for _, ev := range events {
+		if ev.Tid != tid {
+			continue
+		}
+		switch ev.Ph {
+		case "b":
+			open++
+			if open > max {
+				max = open
+			}
+		case "e":
+			open--
+		}
+	}
+	return max
+}
+
+func TestPipelineTraceEnv(t *testing.T) {
+	fastSigners(t)
+	crc32Fast := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		time.Sleep(10 * time.Millisecond)
+		return crc32Fast(data)
+	}
+	path := filepath.Join(t.TempDir(), "trace.json")
+	t.Setenv(traceEnv, path)
+
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range []int{0, 1, 1, 2, 3, 5, 8} {
+				out <- fibNum
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+	)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("trace not written: %v", err)
+	}
+	trace := traceFile{}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("trace is not JSON: %v", err)
+	}
+	threads := map[string]int{}
+	for _, ev := range trace.TraceEvents {
+		if ev.Ph == "M" {
+			threads[ev.Args["name"].(string)] = ev.Tid
+		}
+	}
+	singleTid, ok1 := threads["SingleHash"]
+	multiTid, ok2 := threads["MultiHash"]
+	if !ok1 || !ok2 {
+		t.Fatalf("no stage names in trace: %v", threads)
+	}
+	if maxParallel(trace.TraceEvents, singleTid) < 2 || maxParallel(trace.TraceEvents, multiTid) < 2 {
+		t.Errorf("trace must show parallel items in SingleHash and MultiHash")
+	}
+}
+
+func TestParallelItemLatency(t *testing.T) {
+	//первое значение считается 50 мс, второе приходит через 20 мс и считается 1 мс -
+	//при сопоставлении по порядку вышло бы 21 и 30 мс
+	sleepy := Parallel(2, func(ctx context.Context, val int) (int, error) {
+		time.Sleep(time.Duration(val) * time.Millisecond)
+		return val, nil
+	})
+	source := adaptJob(func(in, out chan interface{}) {
+		out <- 50
+		time.Sleep(20 * time.Millisecond)
+		out <- 1
+	})
+	sink := adaptJob(func(in, out chan interface{}) {
+		for range in {
+		}
+	})
+	stages := map[string]jobCtx{
+		"jobCtx": sleepy.Job(),
+		"job": adaptJob(func(in, out chan interface{}) {
+			runAsJob(sleepy, in, out)
+		}),
+	}
+	for name, stage := range stages {
+		result, err := ExecutePipelineOpts(context.Background(), PipelineOptions{}, source, stage, sink)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		latency := result.Stages[1].Latency
+		if latency.Count != 2 || latency.Max < 50*time.Millisecond || latency.Max > 70*time.Millisecond {
+			t.Errorf("%s: expected 2 items with max 50ms, got %+v", name, latency)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelinePanic(t *testing.T) {
+	var recieved int
+	done := make(chan error)
+	go func() {
+		done <- ExecutePipeline(
+			job(func(in, out chan interface{}) {
+				for i := 0; i < 1000; i++ { //больше, чем влезает в очередь
+					out <- i
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				for val := range in {
+					if val.(int) == 5 {
+						panic("bad value")
+					}
+					out <- val
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				for range in {
+					recieved++
+				}
+			}),
+		)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("pipeline hangs after panic")
+	}
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected PanicError, got %v", err)
+	}
+	if panicErr.Value != "bad value" || !strings.Contains(panicErr.Stage, "TestPipelinePanic") {
+		t.Errorf("unexpected panic error: stage %v, value %v", panicErr.Stage, panicErr.Value)
+	}
+	if !strings.Contains(string(panicErr.Stack), "panic_test.go") {
+		t.Errorf("stack must point to the panic:\n%s", panicErr.Stack)
+	}
+	if recieved != 5 {
+		t.Errorf("downstream stage must get values before the panic, got %d", recieved)
+	}
+}
+
+func TestTypedStagePanic(t *testing.T) {
+	errBad := errors.New("bad value")
+	failing := Stage[int, int](func(ctx context.Context, in <-chan int, out chan<- int) error {
+		for range in {
+			panic(errBad)
+		}
+		return nil
+	})
+	_, err := ExecutePipelineOpts(context.Background(), PipelineOptions{StageNames: []string{"source", "failing"}},
+		append([]jobCtx{adaptJob(func(in, out chan interface{}) {
+			out <- 1
+		})}, NewPipe(failing).Jobs()...)...)
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "failing" {
+		t.Fatalf("expected PanicError in stage failing, got %v", err)
+	}
+	if !errors.Is(err, errBad) {
+		t.Errorf("panic value must be available through errors.Is")
+	}
+}
+
+func TestSingleHashPanic(t *testing.T) {
+	fastSigners(t)
+	DataSignerMd5 = func(data string) string {
+		panic("boom")
+	}
+	err := ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- 0
+		}),
+		job(SingleHash),
+	)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "SingleHash" || panicErr.Value != "boom" {
+		t.Fatalf("expected PanicError boom in stage SingleHash, got %v", err)
+	}
+	if !strings.Contains(string(panicErr.Stack), "panic_test.go") || strings.Contains(string(panicErr.Stack), "runAsJob") {
+		t.Errorf("stack must point to the panic, not to runAsJob:\n%s", panicErr.Stack)
+	}
+
+	//обычная ошибка типизированной стадии внутри job остаётся ошибкой, а не паникой
+	ints := Stage[int, int](func(ctx context.Context, in <-chan int, out chan<- int) error {
+		for val := range in {
+			out <- val
+		}
+		return nil
+	})
+	err = ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- "x"
+		}),
+		job(func(in, out chan interface{}) {
+			runAsJob(ints, in, out)
+		}),
+	)
+	if err == nil || errors.As(err, &panicErr) || err.Error() != "stage input: unexpected string" {
+		t.Errorf("expected plain stage input error, got %v", err)
+	}
+}
+
+func TestPanicErrorMessage(t *testing.T) {
+	err := newPanicError("SingleHash", "boom")
+	if msg := err.Error(); msg != "panic in stage SingleHash: boom" {
+		t.Errorf("error must be one line without the stack, got %q", msg)
+	}
+	if len(err.Stack) == 0 {
+		t.Errorf("stack must stay in the Stack field")
+	}
+}
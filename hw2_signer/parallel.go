@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Parallel - стадия, которая считает fn для каждого значения в n горутин,
+// результаты уходят дальше сразу, как только готовы, порядок входа не сохраняется.
+// Первая ошибка fn останавливает стадию и возвращается из неё
+func Parallel[In, Out any](n int, fn func(ctx context.Context, val In) (Out, error)) Stage[In, Out] {
+	n = max(n, 1)
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		items, ctx := stageItems(ctx)
+		items.measure()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var once sync.Once
+		var firstErr error
+		fail := func(err error) {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					var val In
+					var ok bool
+					select {
+					case val, ok = <-in:
+					case <-ctx.Done():
+						return
+					}
+					if !ok {
+						return
+					}
+					start := time.Now()
+					res, err := callItem(ctx, fn, val)
+					items.done(start)
+					if err != nil {
+						fail(err)
+						return
+					}
+					select {
+					case out <- res:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		return firstErr
+	}
+}
+
+// ParallelOrdered - как Parallel, но результаты уходят в порядке входа:
+// каждый как только готов он и все предыдущие, одновременно считается не больше n значений
+func ParallelOrdered[In, Out any](n int, fn func(ctx context.Context, val In) (Out, error)) Stage[In, Out] {
+	type result struct {
+		val Out
+		err error
+	}
+	n = max(n, 1)
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		items, ctx := stageItems(ctx)
+		items.measure()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		//буфер переупорядочивания, по каналу на значение в порядке входа. n-1, потому что
+		//ещё одно значение - то, результата которого ждёт отправка
+		pending := make(chan chan result, n-1)
+		go func() {
+			defer close(pending)
+			for {
+				var val In
+				var ok bool
+				select {
+				case val, ok = <-in:
+				case <-ctx.Done():
+					return
+				}
+				if !ok {
+					return
+				}
+				resCh := make(chan result, 1)
+				select {
+				case pending <- resCh: //блокируется, если окно заполнено
+				case <-ctx.Done():
+					return
+				}
+				go func() {
+					start := time.Now()
+					res, err := callItem(ctx, fn, val)
+					items.done(start)
+					resCh <- result{res, err}
+				}()
+			}
+		}()
+
+		var firstErr error
+		for resCh := range pending {
+			res := <-resCh
+			if firstErr != nil { //дочитываем, чтобы горутина с входом завершилась
+				continue
+			}
+			if res.err != nil {
+				firstErr = res.err
+				cancel()
+				continue
+			}
+			select {
+			case out <- res.val:
+			case <-ctx.Done():
+				firstErr = ctx.Err()
+			}
+		}
+		return firstErr
+	}
+}
+
+// callItem вызывает fn, превращая панику в ошибку - горутины стадии startWorker не видит
+func callItem[In, Out any](ctx context.Context, fn func(ctx context.Context, val In) (Out, error), val In) (res Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredErr(r)
+		}
+	}()
+	return fn(ctx, val)
+}
+
+// runAsJob запускает стадию внутри старого job. Вернуть ошибку job не может,
+// поэтому она уходит паникой jobError, которую startWorker превратит обратно в ту же ошибку
+func runAsJob[In, Out any](s Stage[In, Out], in, out chan interface{}) {
+	if err := s.Job()(jobContext(in), in, out); err != nil {
+		panic(jobError{err})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sleepy ждёт 20-val мс, поздние значения готовы раньше, и считает одновременные вызовы
+func sleepy(current, max *int32) func(ctx context.Context, val int) (int, error) {
+	return func(ctx context.Context, val int) (int, error) {
+		n := atomic.AddInt32(current, 1)
+		for {
+			m := atomic.LoadInt32(max)
+			if n <= m || atomic.CompareAndSwapInt32(max, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(20-val) * time.Millisecond)
+		atomic.AddInt32(current, -1)
+		return val * 10, nil
+	}
+}
+
+func TestParallelOrdered(t *testing.T) {
+	var current, max int32
+	inputs := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	result, err := NewPipe(ParallelOrdered(4, sleepy(&current, &max))).Run(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, val := range result {
+		if val != inputs[i]*10 {
+			t.Fatalf("expected input order, got %v", result)
+		}
+	}
+	if max > 4 {
+		t.Errorf("expected at most 4 items in flight, got %d", max)
+	}
+}
+
+func TestParallelUnordered(t *testing.T) {
+	var current, max int32
+	result, err := NewPipe(Parallel(3, sleepy(&current, &max))).Run(context.Background(), []int{0, 1, 19})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 3 || result[0] != 190 {
+		t.Errorf("fastest result must go first, got %v", result)
+	}
+	if max > 3 {
+		t.Errorf("expected at most 3 workers, got %d", max)
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	errBad := errors.New("bad value")
+	fn := func(ctx context.Context, val int) (int, error) {
+		if val == 3 {
+			return 0, errBad
+		}
+		return val, nil
+	}
+	inputs := make([]int, 1000)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	for _, stage := range []Stage[int, int]{Parallel(4, fn), ParallelOrdered(4, fn)} {
+		if _, err := NewPipe(stage).Run(context.Background(), inputs); err != errBad {
+			t.Errorf("expected %v, got %v", errBad, err)
+		}
+	}
+}
+
+func TestParallelPanic(t *testing.T) {
+	fn := func(ctx context.Context, val int) (int, error) {
+		panic("bad value")
+	}
+	for _, stage := range []Stage[int, int]{Parallel(4, fn), ParallelOrdered(4, fn)} {
+		_, err := NewPipe(stage).Run(context.Background(), []int{1, 2, 3})
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "bad value" {
+			t.Errorf("expected PanicError, got %v", err)
+		}
+	}
+}
+
+func TestSignerBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("real DataSignerCrc32 sleeps for a second")
+	}
+	var result string
+	start := time.Now()
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range []int{0, 1, 1, 2, 3, 5, 8} {
+				out <- fibNum
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	if end := time.Since(start); end > 3*time.Second {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, 3*time.Second)
+	}
+	if result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+}
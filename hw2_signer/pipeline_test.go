@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineErrorCancels(t *testing.T) {
+	errStage := errors.New("stage failed")
+	jobs := []jobCtx{
+		func(ctx context.Context, in, out chan interface{}) error { //бесконечный источник
+			for i := 0; ; i++ {
+				select {
+				case out <- i:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				if val.(int) == 3 {
+					return errStage
+				}
+				out <- val
+			}
+			return nil
+		},
+		adaptJob(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	}
+
+	start := time.Now()
+	err := ExecutePipelineContext(context.Background(), jobs...)
+	if err != errStage {
+		t.Errorf("expected first error %v, got %v", errStage, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("pipeline was not cancelled")
+	}
+}
+
+func TestPipelineDrainsLegacyJobs(t *testing.T) {
+	errStage := errors.New("stage failed")
+	jobs := []jobCtx{
+		adaptJob(func(in, out chan interface{}) { //не знает про ctx и шлёт больше, чем влезает в буфер
+			for i := 0; i < 1000; i++ {
+				out <- i
+			}
+		}),
+		func(ctx context.Context, in, out chan interface{}) error {
+			<-in
+			return errStage
+		},
+	}
+	done := make(chan error)
+	go func() {
+		done <- ExecutePipelineContext(context.Background(), jobs...)
+	}()
+	select {
+	case err := <-done:
+		if err != errStage {
+			t.Errorf("expected %v, got %v", errStage, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("pipeline hangs on a blocked legacy job")
+	}
+}
+
+func TestPipelineContextTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := ExecutePipelineContext(ctx,
+		adaptJob(func(in, out chan interface{}) {
+			out <- 1
+		}),
+		func(ctx context.Context, in, out chan interface{}) error { //зависшая стадия
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestExecutePipelineNoError(t *testing.T) {
+	var recieved uint32
+	err := ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for range in { //первая стадия получает закрытый канал
+			}
+			out <- uint32(2)
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				atomic.AddUint32(&recieved, val.(uint32))
+			}
+		}),
+	)
+	if err != nil || recieved != 2 {
+		t.Errorf("unexpected result: err %v, recieved %d", err, recieved)
+	}
+}
+
+func TestPipelineStageExitsEarly(t *testing.T) {
+	for _, opts := range []PipelineOptions{{}, {Buffer: 1}, {Unbounded: true}} {
+		var sent, recieved int32
+		done := make(chan error, 1)
+		go func() {
+			_, err := ExecutePipelineOpts(context.Background(), opts,
+				adaptJob(func(in, out chan interface{}) {
+					for i := 0; i < 2*MaxInputDataLen; i++ { //больше, чем влезает в очередь по умолчанию
+						out <- i
+						atomic.AddInt32(&sent, 1)
+					}
+				}),
+				adaptJob(func(in, out chan interface{}) {
+					<-in //дальше вход не читаем
+					out <- 1
+				}),
+				adaptJob(func(in, out chan interface{}) {
+					for range in {
+						atomic.AddInt32(&recieved, 1)
+					}
+				}),
+			)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil || sent != 2*MaxInputDataLen || recieved != 1 {
+				t.Errorf("%+v: unexpected result: err %v, sent %d, recieved %d", opts, err, sent, recieved)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%+v: pipeline hangs when a stage exits before reading its input", opts)
+		}
+	}
+}
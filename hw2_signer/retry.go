@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy - как Retry обрабатывает значения, которые стадия не смогла обработать
+type RetryPolicy struct {
+	Attempts   int           // всего попыток на значение, 0 - 1
+	Timeout    time.Duration // срок одной попытки, 0 - без срока
+	Backoff    time.Duration // пауза перед второй попыткой, дальше удваивается
+	MaxBackoff time.Duration // пауза не больше, 0 - без ограничения
+	Jitter     float64       // пауза случайно меняется на эту долю в обе стороны, 0..1
+	Workers    int           // сколько значений обрабатывается одновременно, 0 - MaxInputDataLen
+	Unordered  bool          // результаты уходят по готовности, по умолчанию - в порядке входа, как у SingleHash
+}
+
+// DeadLetter - значение, которое не обработалось за все попытки.
+// Стадия отправляет его в out, очередь после стадии забирает его в PipelineResult.DeadLetters
+type DeadLetter struct {
+	Stage    string
+	Item     interface{}
+	Attempts int
+	Err      error // ошибка последней попытки
+}
+
+// DeadLetterError - ExecutePipeline и ExecutePipelineContext возвращают её, если конвейер
+// дошёл до конца, но часть значений ушла в dead letters
+type DeadLetterError struct {
+	Letters []DeadLetter
+}
+
+func (e *DeadLetterError) Error() string {
+	first := e.Letters[0]
+	return fmt.Sprintf("%d items failed, first: stage %s item %v after %d attempts: %v",
+		len(e.Letters), first.Stage, first.Item, first.Attempts, first.Err)
+}
+
+// Retry - стадия job, которая получает значения по одному: каждое - отдельным запуском job
+// со своим входом, так что подходит для стадий вроде SingleHash и MultiHash, но не CombineResults.
+// Паника в job - неудачная попытка. После policy.Attempts неудач значение уходит в dead letters,
+// остальные значения обрабатываются дальше. Порядок входа сохраняется, если не задан policy.Unordered
+func Retry(policy RetryPolicy, freeFlowJob job) job {
+	stage := RetryCtx(policy, adaptJob(freeFlowJob))
+	return func(in, out chan interface{}) {
+		stage(jobContext(in), in, out) //без отмены ошибки не бывает
+	}
+}
+
+// RetryCtx - Retry для стадии с ctx: попытка неудачна, если стадия вернула ошибку или не успела за Timeout
+func RetryCtx(policy RetryPolicy, j jobCtx) jobCtx {
+	fn := func(ctx context.Context, item interface{}) ([]interface{}, error) {
+		return policy.do(ctx, j, item)
+	}
+	stage := ParallelOrdered(policy.workers(), fn)
+	if policy.Unordered {
+		stage = Parallel(policy.workers(), fn)
+	}
+	return func(ctx context.Context, in, out chan interface{}) error {
+		results := make(chan []interface{})
+		errCh := make(chan error, 1)
+		go func() {
+			defer close(results)
+			errCh <- stage(ctx, in, results)
+		}()
+		for vals := range results {
+			for _, val := range vals {
+				select {
+				case out <- val:
+				case <-ctx.Done():
+				}
+			}
+		}
+		return <-errCh
+	}
+}
+
+func (p RetryPolicy) workers() int {
+	if p.Workers > 0 {
+		return p.Workers
+	}
+	return MaxInputDataLen
+}
+
+// do обрабатывает item с повторами, возвращает выход удачной попытки или DeadLetter.
+// Ошибка - только если отменили ctx всего конвейера
+func (p RetryPolicy) do(ctx context.Context, j jobCtx, item interface{}) ([]interface{}, error) {
+	attempts := max(p.Attempts, 1)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(p.delay(attempt-1, rand.Float64())):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		var vals []interface{}
+		if vals, err = p.attempt(ctx, j, item); err == nil {
+			return vals, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return []interface{}{DeadLetter{Item: item, Attempts: attempts, Err: err}}, nil
+}
+
+// delay - пауза перед повтором номер retry (с 1), rnd - случайное число из [0, 1)
+func (p RetryPolicy) delay(retry int, rnd float64) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return time.Duration(float64(d) * (1 + p.Jitter*(2*rnd-1)))
+}
+
+// errAttemptTimeout - попытка не уложилась в RetryPolicy.Timeout
+var errAttemptTimeout = errors.New("attempt timed out")
+
+// attempt запускает j для одного item. Выход попытки копится и отдаётся только при успехе,
+// чтобы неудачные попытки не оставили в конвейере лишних значений
+func (p RetryPolicy) attempt(ctx context.Context, j jobCtx, item interface{}) ([]interface{}, error) {
+	attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+	if p.Timeout > 0 {
+		attemptCtx, cancel = context.WithTimeout(ctx, p.Timeout)
+	}
+	defer cancel()
+
+	in := make(chan interface{}, 1)
+	in <- item
+	close(in)
+	out := make(chan interface{})
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- recoveredErr(r)
+			}
+		}()
+		errCh <- j(attemptCtx, in, out)
+	}()
+
+	collected := make(chan []interface{}, 1)
+	go func() { //дочитываем out и после таймаута, чтобы зависшая попытка не встала на отправке
+		var vals []interface{}
+		for val := range out {
+			vals = append(vals, val)
+		}
+		collected <- vals
+	}()
+
+	select {
+	case vals := <-collected:
+		return vals, <-errCh
+	case <-attemptCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errAttemptTimeout
+	}
+}
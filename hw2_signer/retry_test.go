@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky - стадия x -> x*10, которая для значения bad падает первые fails раз, -1 - всегда
+func flaky(bad, fails int, calls *int32) jobCtx {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		for val := range in {
+			if val.(int) == bad && (fails < 0 || int(atomic.AddInt32(calls, 1)) <= fails) {
+				return errors.New("flaky")
+			}
+			out <- val.(int) * 10
+		}
+		return nil
+	}
+}
+
+// runCollect прогоняет 1..n через стадию и возвращает выход по возрастанию
+func runCollect(t *testing.T, n int, stage jobCtx) ([]int, *PipelineResult, error) {
+	var got []int
+	res, err := ExecutePipelineOpts(context.Background(), PipelineOptions{StageNames: []string{"source", "retry", "sink"}},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for i := 1; i <= n; i++ {
+				out <- i
+			}
+			return nil
+		},
+		stage,
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				got = append(got, val.(int))
+			}
+			return nil
+		},
+	)
+	sort.Ints(got)
+	return got, res, err
+}
+
+func TestRetryRecovers(t *testing.T) {
+	var calls int32
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	got, res, err := runCollect(t, 5, RetryCtx(policy, flaky(3, 2, &calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{10, 20, 30, 40, 50}; !slices.Equal(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	if calls != 3 || len(res.DeadLetters) != 0 {
+		t.Errorf("calls %d, dead letters %v", calls, res.DeadLetters)
+	}
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	var calls int32
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	got, res, err := runCollect(t, 5, RetryCtx(policy, flaky(3, -1, &calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{10, 20, 40, 50}; !slices.Equal(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	if len(res.DeadLetters) != 1 {
+		t.Fatalf("dead letters %v", res.DeadLetters)
+	}
+	dl := res.DeadLetters[0]
+	if dl.Stage != "retry" || dl.Item != 3 || dl.Attempts != 3 || dl.Err == nil || dl.Err.Error() != "flaky" {
+		t.Errorf("unexpected dead letter %+v", dl)
+	}
+	if res.Stages[1].Out != 4 {
+		t.Errorf("dead letter counted as stage output: %d", res.Stages[1].Out)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	var calls int32
+	slowOnce := func(ctx context.Context, in, out chan interface{}) error {
+		for val := range in {
+			if val.(int) == 2 && atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done() //первая попытка зависает до срока
+				return ctx.Err()
+			}
+			out <- val
+		}
+		return nil
+	}
+	start := time.Now()
+	policy := RetryPolicy{Attempts: 2, Timeout: 50 * time.Millisecond}
+	got, _, err := runCollect(t, 3, RetryCtx(policy, slowOnce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []int{1, 2, 3}) || calls != 2 {
+		t.Errorf("got %v after %d calls", got, calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v", elapsed)
+	}
+
+	// legacy job не видит ctx - попытка бросается по сроку, а её выход не попадает дальше
+	release := make(chan struct{})
+	defer close(release)
+	stuck := Retry(RetryPolicy{Attempts: 2, Timeout: 20 * time.Millisecond}, func(in, out chan interface{}) {
+		for val := range in {
+			if val.(int) == 2 {
+				out <- -1
+				<-release
+			}
+			out <- val
+		}
+	})
+	got, res, err := runCollect(t, 3, adaptJob(stuck))
+	var dlErr *DeadLetterError
+	if err != nil || len(res.DeadLetters) != 1 || !errors.Is(res.DeadLetters[0].Err, errAttemptTimeout) {
+		t.Fatalf("err %v, dead letters %+v", err, res.DeadLetters)
+	}
+	if !slices.Equal(got, []int{1, 3}) {
+		t.Errorf("got %v", got)
+	}
+	if err := deadLetterErr(res, nil); !errors.As(err, &dlErr) || len(dlErr.Letters) != 1 {
+		t.Errorf("expected DeadLetterError, got %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	var delays []time.Duration
+	for retry := 1; retry <= 5; retry++ {
+		delays = append(delays, p.delay(retry, 0.5))
+	}
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i := range expected {
+		if delays[i] != expected[i]*time.Millisecond {
+			t.Errorf("delays %v", delays)
+			break
+		}
+	}
+
+	p.Jitter = 0.5
+	if lo, hi := p.delay(2, 0), p.delay(2, 0.999999); lo != 10*time.Millisecond || hi < 29*time.Millisecond || hi > 30*time.Millisecond {
+		t.Errorf("jitter range %v..%v", lo, hi)
+	}
+}
+
+func TestRetrySigner(t *testing.T) {
+	fastSigners(t)
+
+	// SingleHash падает на первой попытке для каждого третьего значения
+	var mu sync.Mutex
+	failed := map[string]bool{}
+	chain := defaultChain
+	chain.Inner = SignerFunc(func(data string) string {
+		mu.Lock()
+		first := !failed[data] && len(failed)%3 == 0
+		failed[data] = true
+		mu.Unlock()
+		if first {
+			panic("md5 unavailable")
+		}
+		return callMd5(data)
+	})
+	policy := RetryPolicy{Attempts: 2}
+	var result string
+	err := ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, val := range []int{0, 1, 1, 2, 3, 5, 8} {
+				out <- val
+			}
+		}),
+		Retry(policy, chain.SingleHash),
+		Retry(policy, MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+}
+
+func TestRetryOrder(t *testing.T) {
+	fastSigners(t)
+	// первое значение проходит только со второй попытки, после остальных
+	var calls int32
+	chain := defaultChain
+	chain.Inner = SignerFunc(func(data string) string {
+		if data == "0" && atomic.AddInt32(&calls, 1) == 1 {
+			panic("md5 unavailable")
+		}
+		return callMd5(data)
+	})
+	inputs := []int{0, 1, 2, 3}
+	run := func(policy RetryPolicy) []string {
+		var got []string
+		err := ExecutePipeline(
+			job(func(in, out chan interface{}) {
+				for _, val := range inputs {
+					out <- val
+				}
+			}),
+			Retry(policy, chain.SingleHash),
+			job(func(in, out chan interface{}) {
+				for val := range in {
+					got = append(got, val.(string))
+				}
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	got := run(RetryPolicy{Attempts: 2, Backoff: 20 * time.Millisecond})
+	for i, val := range inputs {
+		if expected := defaultChain.singleHash(strconv.Itoa(val)); i >= len(got) || got[i] != expected {
+			t.Fatalf("SingleHash under Retry must keep input order, got %v", got)
+		}
+	}
+
+	calls = 0
+	got = run(RetryPolicy{Attempts: 2, Backoff: 20 * time.Millisecond, Unordered: true})
+	if len(got) != len(inputs) || got[len(got)-1] != defaultChain.singleHash("0") {
+		t.Errorf("unordered Retry must let the retried value go last, got %v", got)
+	}
+}
+
+func TestRetryGraph(t *testing.T) {
+	var calls int32
+	var got []int
+	err := NewGraph().
+		Stage("src", ints(1, 2, 3)).
+		Stage("retry", RetryCtx(RetryPolicy{Attempts: 2}, flaky(2, -1, &calls)), "src").
+		Stage("sink", collect(&sync.Mutex{}, &got), "retry").
+		Run(context.Background())
+	var dlErr *DeadLetterError
+	if !errors.As(err, &dlErr) || len(dlErr.Letters) != 1 || dlErr.Letters[0].Stage != "retry" || dlErr.Letters[0].Item != 2 {
+		t.Fatalf("expected dead letter for 2, got %v", err)
+	}
+	sort.Ints(got)
+	if !slices.Equal(got, []int{10, 30}) {
+		t.Errorf("got %v", got)
+	}
+}
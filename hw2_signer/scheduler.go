@@ -0,0 +1,141 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Scheduler раздаёт доступ к ресурсам, которые можно вызывать не более N раз одновременно,
+// ожидающие получают доступ в порядке очереди
+type Scheduler struct {
+	mu        sync.Mutex
+	resources map[string]*resource
+}
+
+// ResourceStats - статистика ожидания ресурса
+type ResourceStats struct {
+	Acquired  int           // сколько раз ресурс выдан
+	Waited    int           // сколько из них пришлось ждать в очереди
+	TotalWait time.Duration // суммарное время ожидания
+	MaxWait   time.Duration // самое долгое ожидание
+}
+
+type resource struct {
+	capacity int
+	busy     int
+	queue    *list.List //*waiter в порядке прихода
+	stats    ResourceStats
+}
+
+type waiter struct {
+	ready chan struct{} //закрывается, когда слот передан этому ожидающему
+}
+
+// NewScheduler создаёт планировщик без ресурсов
+func NewScheduler() *Scheduler {
+	return &Scheduler{resources: map[string]*resource{}}
+}
+
+// Register добавляет ресурс, который одновременно могут держать capacity вызывающих.
+// Повторно зарегистрировать имя нельзя - у занятого ресурса потерялись бы слоты и очередь
+func (s *Scheduler) Register(name string, capacity int) error {
+	if capacity < 1 {
+		return fmt.Errorf("scheduler: resource %q capacity %d, must be at least 1", name, capacity)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.resources[name]; ok {
+		return fmt.Errorf("scheduler: resource %q already registered", name)
+	}
+	s.resources[name] = &resource{capacity: capacity, queue: list.New()}
+	return nil
+}
+
+// Acquire занимает слот ресурса, ждёт в очереди, если все заняты, или пока не отменят ctx.
+// Возвращает, сколько пришлось ждать. Слот нужно вернуть через Release
+func (s *Scheduler) Acquire(ctx context.Context, name string) (time.Duration, error) {
+	start := time.Now()
+	s.mu.Lock()
+	res, ok := s.resources[name]
+	if !ok {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("scheduler: unknown resource %q", name)
+	}
+	if res.busy < res.capacity && res.queue.Len() == 0 {
+		res.busy++
+		res.stats.Acquired++
+		s.mu.Unlock()
+		return 0, nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	elem := res.queue.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready: //слот успели передать - возвращаем его следующему
+			s.mu.Unlock()
+			s.Release(name)
+		default:
+			res.queue.Remove(elem)
+			s.mu.Unlock()
+		}
+		return time.Since(start), ctx.Err()
+	}
+
+	waited := time.Since(start)
+	s.mu.Lock()
+	res.stats.Acquired++
+	res.stats.Waited++
+	res.stats.TotalWait += waited
+	if waited > res.stats.MaxWait {
+		res.stats.MaxWait = waited
+	}
+	s.mu.Unlock()
+	return waited, nil
+}
+
+// Release возвращает слот, полученный через Acquire. Release без Acquire - ошибка программы, паника
+func (s *Scheduler) Release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.resources[name]
+	if !ok {
+		panic(fmt.Sprintf("scheduler: release of unknown resource %q", name))
+	}
+	if res.busy == 0 {
+		panic(fmt.Sprintf("scheduler: release of resource %q that is not acquired", name))
+	}
+	if front := res.queue.Front(); front != nil {
+		res.queue.Remove(front)
+		close(front.Value.(*waiter).ready) //слот переходит первому в очереди, busy не меняется
+		return
+	}
+	res.busy--
+}
+
+// Do вызывает fn, заняв слот ресурса
+func (s *Scheduler) Do(ctx context.Context, name string, fn func()) error {
+	if _, err := s.Acquire(ctx, name); err != nil {
+		return err
+	}
+	defer s.Release(name)
+	fn()
+	return nil
+}
+
+// Stats возвращает статистику ожидания ресурса
+func (s *Scheduler) Stats(name string) ResourceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if res, ok := s.resources[name]; ok {
+		return res.stats
+	}
+	return ResourceStats{}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// queueLen - сколько вызывающих ждёт ресурс
+func queueLen(s *Scheduler, name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resources[name].queue.Len()
+}
+
+func waitQueueLen(t *testing.T, s *Scheduler, name string, n int) {
+	deadline := time.Now().Add(time.Second)
+	for queueLen(s, name) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiters, got %d", n, queueLen(s, name))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerFIFO(t *testing.T) {
+	s := NewScheduler()
+	s.Register("res", 1)
+	if _, err := s.Acquire(context.Background(), "res"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var order []int
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Do(context.Background(), "res", func() {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+			})
+		}(i)
+		waitQueueLen(t, s, "res", i+1) //следующий встаёт в очередь только после текущего
+	}
+	time.Sleep(10 * time.Millisecond)
+	s.Release("res")
+	wg.Wait()
+
+	for i, val := range order {
+		if i != val {
+			t.Fatalf("expected FIFO order, got %v", order)
+		}
+	}
+	stats := s.Stats("res")
+	if stats.Acquired != 6 || stats.Waited != 5 || stats.MaxWait < 10*time.Millisecond || stats.TotalWait < stats.MaxWait {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSchedulerCapacity(t *testing.T) {
+	s := NewScheduler()
+	s.Register("res", 3)
+
+	var current, max int32
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Do(context.Background(), "res", func() {
+				n := atomic.AddInt32(&current, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&current, -1)
+			})
+		}()
+	}
+	wg.Wait()
+	if max > 3 {
+		t.Errorf("expected at most 3 concurrent calls, got %d", max)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := NewScheduler()
+	s.Register("res", 1)
+	s.Acquire(context.Background(), "res")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	waited, err := s.Acquire(ctx, "res")
+	if !errors.Is(err, context.DeadlineExceeded) || waited < 20*time.Millisecond {
+		t.Errorf("expected deadline after 20ms, got %v after %v", err, waited)
+	}
+	if queueLen(s, "res") != 0 {
+		t.Errorf("cancelled waiter must leave the queue")
+	}
+
+	s.Release("res")
+	if _, err := s.Acquire(context.Background(), "res"); err != nil {
+		t.Errorf("slot must be free after release: %v", err)
+	}
+	if _, err := s.Acquire(context.Background(), "unknown"); err == nil {
+		t.Errorf("expected error for unknown resource")
+	}
+}
+
+func TestSchedulerRegister(t *testing.T) {
+	s := NewScheduler()
+	if err := s.Register("res", 0); err == nil {
+		t.Errorf("expected error for zero capacity")
+	}
+	if err := s.Register("res", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Acquire(context.Background(), "res")
+	if err := s.Register("res", 1); err == nil {
+		t.Errorf("expected error for duplicate resource")
+	}
+	if st := s.Stats("res"); st.Acquired != 1 {
+		t.Errorf("duplicate register must keep the resource, got %+v", st)
+	}
+
+	mustPanic := func(name string) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected panic on release of %q", name)
+			}
+		}()
+		s.Release(name)
+	}
+	mustPanic("unknown")
+	s.Release("res")
+	mustPanic("res")
+}
+
+func TestSingleHashMd5Resource(t *testing.T) {
+	fastSigners(t)
+	md5Fast := DataSignerMd5
+	var current int32
+	DataSignerMd5 = func(data string) string {
+		if atomic.AddInt32(&current, 1) > 1 {
+			t.Errorf("DataSignerMd5 overheat")
+		}
+		defer atomic.AddInt32(&current, -1)
+		time.Sleep(time.Millisecond)
+		return md5Fast(data)
+	}
+
+	before := signerResources.Stats(resourceMd5)
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 20; i++ {
+				out <- i
+			}
+		}),
+		job(SingleHash),
+	)
+	after := signerResources.Stats(resourceMd5)
+	if after.Acquired-before.Acquired != 20 || after.Waited == before.Waited {
+		t.Errorf("expected 20 md5 calls through the scheduler with waiting, got %+v", after)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// NotifyDrain ловит сигналы sigs, по умолчанию SIGINT и SIGTERM. Первый сигнал закрывает drain -
+// его передают в PipelineOptions.Drain, чтобы конвейер доработал то, что уже взял, и закончил.
+// Второй отменяет возвращённый ctx - конвейер останавливается сразу. stop перестаёт ловить сигналы
+func NotifyDrain(ctx context.Context, sigs ...os.Signal) (_ context.Context, drain <-chan struct{}, stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	drainCh := make(chan struct{})
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, sigs...)
+	go func() {
+		received := 0
+		for {
+			select {
+			case <-sigCh:
+				received++
+				if received == 1 {
+					close(drainCh)
+				} else {
+					cancel()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return ctx, drainCh, func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			cancel()
+		})
+	}
+}
@@ -0,0 +1,159 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// slowChain - цепочка на быстрых функциях подписи, но с 10ms на каждый crc32 и не больше 2 значений сразу
+func slowChain(t *testing.T) HashChain {
+	fastSigners(t)
+	chain := defaultChain
+	chain.Outer = SignerFunc(func(data string) string {
+		time.Sleep(10 * time.Millisecond)
+		return callCrc32(data)
+	})
+	chain.Workers = 2
+	return chain
+}
+
+func numbers(n int) []string {
+	inputs := make([]string, n)
+	for i := range inputs {
+		inputs[i] = strconv.Itoa(i)
+	}
+	return inputs
+}
+
+// signalAfter отправляет сигнал своему процессу через d, ждать его - через <-sent
+func signalAfter(t *testing.T, d time.Duration, sig syscall.Signal) (sent chan struct{}) {
+	sent = make(chan struct{})
+	go func() {
+		defer close(sent)
+		time.Sleep(d)
+		if err := syscall.Kill(syscall.Getpid(), sig); err != nil {
+			t.Error(err)
+		}
+	}()
+	return sent
+}
+
+func TestPipelineDrainSignal(t *testing.T) {
+	chain := slowChain(t)
+	inputs := numbers(50)
+
+	ctx, drain, stop := NotifyDrain(context.Background())
+	defer stop()
+	sent := signalAfter(t, 60*time.Millisecond, syscall.SIGINT)
+	defer func() { <-sent }() //сигнал не должен прийти после stop
+
+	var result string
+	res, err := ExecutePipelineOpts(ctx, PipelineOptions{Drain: drain},
+		sourceJob(inputs),
+		chain.SingleHashStage().Job(),
+		chain.MultiHashStage().Job(),
+		adaptJob(CombineResults),
+		adaptJob(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Drained {
+		t.Fatalf("pipeline was not drained")
+	}
+
+	// всё, что SingleHash успел взять, досчитано, а взять он мог только начало входа
+	taken := res.Stages[1].In
+	signed := strings.Count(result, "_") + 1
+	if taken == 0 || taken >= len(inputs) || signed != taken {
+		t.Fatalf("taken %d, signed %d of %d inputs", taken, signed, len(inputs))
+	}
+	report, err := chain.Verify(context.Background(), inputs[:taken], result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("partial result does not match: %v", err)
+	}
+}
+
+func TestRunSignerDrainSignal(t *testing.T) {
+	chain := slowChain(t)
+	inputs := numbers(50)
+
+	ctx, drain, stop := NotifyDrain(context.Background())
+	defer stop()
+	sent := signalAfter(t, 60*time.Millisecond, syscall.SIGTERM)
+	defer func() { <-sent }()
+
+	out := &bytes.Buffer{}
+	err := runSigner(ctx, signerConfig{chain: chain, format: "json", drain: drain, drainTimeout: time.Second}, inputs, out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) == 0 || len(lines) >= len(inputs) {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	expected := "interrupted: signed " + strconv.Itoa(len(lines)) + " of 50 inputs"
+	if err == nil || err.Error() != expected {
+		t.Errorf("got error %v, expected %q", err, expected)
+	}
+}
+
+func TestPipelineDrainTimeout(t *testing.T) {
+	drain := make(chan struct{})
+	start := time.Now()
+	time.AfterFunc(20*time.Millisecond, func() { close(drain) })
+	_, err := ExecutePipelineOpts(context.Background(), PipelineOptions{Drain: drain, DrainTimeout: 50 * time.Millisecond},
+		func(ctx context.Context, in, out chan interface{}) error { //бесконечный источник
+			for i := 0; ; i++ {
+				select {
+				case out <- i:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error { //зависает на первом значении
+			<-in
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	)
+	if !errors.Is(err, ErrDrainTimeout) {
+		t.Errorf("expected %v, got %v", ErrDrainTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond || elapsed > time.Second {
+		t.Errorf("stopped after %v", elapsed)
+	}
+}
+
+func TestNotifyDrainSecondSignal(t *testing.T) {
+	ctx, drain, stop := NotifyDrain(context.Background(), syscall.SIGUSR1)
+	defer stop()
+
+	<-signalAfter(t, 0, syscall.SIGUSR1)
+	select {
+	case <-drain:
+	case <-time.After(time.Second):
+		t.Fatalf("first signal did not start drain")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("first signal cancelled ctx")
+	}
+
+	<-signalAfter(t, 0, syscall.SIGUSR1)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("second signal did not cancel ctx")
+	}
+}
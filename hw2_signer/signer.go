@@ -1,153 +1,470 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
-// ExecutePipeline ...
-func ExecutePipeline(freeFlowJobs ...job) {
-	wg := &sync.WaitGroup{}
-	in := make(chan interface{}, 0) //для первой горутины где нет вхожных данных
+// jobCtx - стадия конвейера, которая умеет останавливаться по ctx и возвращать ошибку
+type jobCtx func(ctx context.Context, in, out chan interface{}) error
+
+// adaptJob позволяет передать старый job в ExecutePipelineContext. Такая стадия не видит ctx,
+// и отмена её не останавливает: она работает, пока не кончится вход. Если следующая стадия
+// закончилась раньше, её вход вычитывается, так что на отправке старый job не зависнет
+func adaptJob(freeFlowJob job) jobCtx {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		freeFlowJob(in, out)
+		return nil
+	}
+}
+
+// traceEnv - если переменная задана, ExecutePipeline пишет в этот файл трассировку запуска
+const traceEnv = "SIGNER_TRACE"
+
+// ExecutePipeline запускает job'ы конвейером, каждый в своей горутине
+func ExecutePipeline(freeFlowJobs ...job) error {
+	jobs := make([]jobCtx, 0, len(freeFlowJobs))
+	opts := PipelineOptions{}
 	for _, valJob := range freeFlowJobs {
-		wg.Add(1)
-		out := make(chan interface{}, 100) //Вы можете ожидать, что у вас никогда не будет более 100 элементов во входных данных
-		go startWorker(wg, valJob, in, out)
-		in = out
+		jobs = append(jobs, adaptJob(valJob))
+		opts.StageNames = append(opts.StageNames, funcName(valJob))
+	}
+	path := os.Getenv(traceEnv)
+	if path == "" {
+		return deadLetterErr(ExecutePipelineOpts(context.Background(), opts, jobs...))
+	}
+
+	opts.Trace = NewTracer()
+	err := deadLetterErr(ExecutePipelineOpts(context.Background(), opts, jobs...))
+	file, fileErr := os.Create(path)
+	if fileErr == nil {
+		fileErr = opts.Trace.WriteJSON(file)
+		if closeErr := file.Close(); fileErr == nil {
+			fileErr = closeErr
+		}
+	}
+	if err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+// funcName - имя функции без пакета, например SingleHash или TestSigner.func5
+func funcName(fn interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name() //main.SingleHash
+	name = name[strings.LastIndex(name, "/")+1:]
+	return name[strings.Index(name, ".")+1:]
+}
+
+// ExecutePipelineContext запускает стадии конвейером. Первая ошибка отменяет ctx всех стадий,
+// каналы между ними вычитываются до закрытия, и эта ошибка возвращается после завершения всех стадий.
+// Если ошибок не было, но Retry отправил значения в dead letters, вернётся *DeadLetterError
+func ExecutePipelineContext(ctx context.Context, jobs ...jobCtx) error {
+	return deadLetterErr(ExecutePipelineOpts(ctx, PipelineOptions{}, jobs...))
+}
+
+// PipelineOptions - настройки конвейера для ExecutePipelineOpts
+type PipelineOptions struct {
+	Buffer         int           // очередь после каждой стадии, 0 - MaxInputDataLen
+	StageBuffers   map[int]int   // очередь после стадии с данным номером, перекрывает Buffer, меньше 1 - 1
+	Unbounded      bool          // очереди между стадиями без ограничения, отправка никогда не ждёт
+	StageNames     []string      // имена стадий для метрик и трассировки, по умолчанию stage0, stage1...
+	SampleInterval time.Duration // как часто записывать длину очередей, 0 - не записывать (с Trace - раз в 10 мс)
+	Trace          *Tracer       // куда писать события для Chrome trace-event, nil - никуда
+
+	// Drain - когда закрыт, конвейер перестаёт брать новые значения из первой стадии,
+	// значения, которые уже дальше неё, дорабатываются, и стадии заканчиваются как при конце входа
+	Drain        <-chan struct{}
+	DrainTimeout time.Duration // если после Drain конвейер не закончил за это время - ErrDrainTimeout, 0 - ждать сколько нужно
+}
+
+// ErrDrainTimeout - конвейер не успел доработать за PipelineOptions.DrainTimeout и был отменён
+var ErrDrainTimeout = errors.New("pipeline: drain timeout")
+
+func (o PipelineOptions) bufferFor(stage int) int {
+	if o.Unbounded {
+		return -1
+	}
+	if size, ok := o.StageBuffers[stage]; ok {
+		if size < 1 {
+			return 1
+		}
+		return size
+	}
+	if o.Buffer > 0 {
+		return o.Buffer
+	}
+	return MaxInputDataLen //Вы можете ожидать, что у вас никогда не будет более 100 элементов во входных данных
+}
+
+func (o PipelineOptions) stageName(stage int) string {
+	if stage < len(o.StageNames) && o.StageNames[stage] != "" {
+		return o.StageNames[stage]
 	}
+	return "stage" + strconv.Itoa(stage)
+}
+
+// ExecutePipelineOpts - ExecutePipelineContext с настройкой очередей, возвращает метрики стадий
+func ExecutePipelineOpts(ctx context.Context, opts PipelineOptions, jobs ...jobCtx) (*PipelineResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &pipelineRun{cancel: cancel}
+	names := make([]string, len(jobs))
+	for i := range jobs {
+		names[i] = opts.stageName(i)
+	}
+	rec := newPipelineRecorder(names, opts.Trace)
+	if opts.Drain != nil && len(jobs) > 0 {
+		jobs = append([]jobCtx{drainSource(opts.Drain, jobs[0])}, jobs[1:]...)
+	}
+
+	wg := &sync.WaitGroup{}
+	in := make(chan interface{}) //для первой горутины где нет вхожных данных
+	close(in)
+	queues := make([]*stageQueue, 0, len(jobs))
+	for i, valJob := range jobs {
+		wg.Add(2)
+		q := &stageQueue{
+			stage:    i,
+			from:     make(chan interface{}), //стадия пишет сюда, очередь замеряет ожидание
+			to:       make(chan interface{}),
+			capacity: opts.bufferFor(i),
+			rec:      rec,
+		}
+		if i == 0 {
+			q.stop = opts.Drain
+		}
+		go q.run(wg)
+		go startWorker(ctx, wg, run, rec, i, valJob, in, q.from)
+		queues = append(queues, q)
+		in = q.to
+	}
+	go drain(in) //выход последней стадии никто не читает
+
+	interval := opts.SampleInterval
+	if interval == 0 && opts.Trace != nil {
+		interval = 10 * time.Millisecond
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	drained := false
+	go func() {
+		defer close(stopped)
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		drainCh := opts.Drain
+		var drainDeadline <-chan time.Time
+		for {
+			select {
+			case <-tick:
+				rec.sample(queues)
+			case <-drainCh:
+				drainCh, drained = nil, true
+				if opts.DrainTimeout > 0 {
+					timer := time.NewTimer(opts.DrainTimeout)
+					defer timer.Stop()
+					drainDeadline = timer.C
+				}
+			case <-drainDeadline:
+				run.fail(ErrDrainTimeout) //отменит ctx, дальше - как при любой ошибке
+			case <-ctx.Done():
+				run.fail(ctx.Err()) //застрявших на отправке освободит startWorker, когда стадия после них закончится
+				<-done
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
 	wg.Wait()
+	close(done)
+	<-stopped
+	if interval > 0 {
+		rec.sample(queues)
+	}
+	return &PipelineResult{Stages: rec.stages, DeadLetters: rec.dead, Drained: drained}, run.err
+}
+
+// drainSource - первая стадия, у которой ctx отменяется по drain. Остановленная так стадия
+// закончилась без ошибки, даже если вернула context.Canceled
+func drainSource(drain <-chan struct{}, source jobCtx) jobCtx {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		sourceCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-drain:
+				cancel()
+			case <-sourceCtx.Done():
+			}
+		}()
+		err := source(sourceCtx, in, out)
+		if errors.Is(err, context.Canceled) && sourceCtx.Err() != nil && ctx.Err() == nil {
+			return nil
+		}
+		return err
+	}
+}
+
+// deadLetterErr - ошибка для ExecutePipeline и ExecutePipelineContext, если конвейер прошёл, но с dead letters
+func deadLetterErr(res *PipelineResult, err error) error {
+	if err == nil && len(res.DeadLetters) > 0 {
+		return &DeadLetterError{Letters: res.DeadLetters}
+	}
+	return err
+}
+
+// pipelineRun - общее состояние одного запуска конвейера
+type pipelineRun struct {
+	once   sync.Once
+	err    error
+	cancel context.CancelFunc
+}
+
+// fail запоминает первую ошибку и отменяет остальные стадии
+func (r *pipelineRun) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+		r.cancel()
+	})
+}
+
+func drain(ch chan interface{}) {
+	for range ch {
+	}
 }
 
 // startWorker ...
-func startWorker(wg *sync.WaitGroup, freeFlowJob job, in chan interface{}, out chan interface{}) {
+func startWorker(ctx context.Context, wg *sync.WaitGroup, run *pipelineRun, rec *pipelineRecorder, stage int, freeFlowJob jobCtx, in chan interface{}, out chan interface{}) {
 	defer wg.Done()
-	freeFlowJob(in, out)
-	close(out)
+	rec.stageStarted(stage)
+	defer rec.stageFinished(stage)
+	defer close(out) //следующая стадия должна закончиться и после паники
+	defer func() {
+		go drain(in) //стадия могла выйти, не дочитав вход - иначе предыдущая встанет на отправке
+	}()
+	items := &itemRecorder{rec: rec, stage: stage}
+	ctx = context.WithValue(ctx, itemRecorderKey{}, items)
+	jobItems.Store(in, items)
+	defer jobItems.Delete(in)
+	fail := func(err error) {
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) && panicErr.Stage == "" { //паника во вложенной горутине стадии
+			panicErr.Stage = rec.names[stage]
+		}
+		run.fail(err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fail(recoveredErr(r))
+		}
+	}()
+	if err := freeFlowJob(ctx, in, out); err != nil {
+		fail(err)
+	}
 }
 
-type dataStruct struct {
-	indexNum   int
-	dataString string
+// jobError - ошибка типизированной стадии, которую runAsJob выносит из старого job паникой
+type jobError struct {
+	err error
 }
 
-// SingleHash считает значение crc32(data)+"~"+crc32(md5(data)) ( конкатенация двух строк через ~), где data - то что пришло на вход (по сути - числа из первой функции)
-func SingleHash(in, out chan interface{}) {
-	outChannelCRC32MD5 := make(chan dataStruct, 100) // data2 := DataSignerCrc32(md5Sum)
-	outChannelCRC32 := make(chan dataStruct, 100)    // data1 := DataSignerCrc32(data)
+func (e jobError) Error() string {
+	return e.err.Error()
+}
 
-	mut := &sync.Mutex{}
-	wg1 := &sync.WaitGroup{}
-	var i int
-	for idata := range in {
-		data := fmt.Sprintf("%v", idata) //data := (<-in).(string)
-		// fmt.Println(i, "SingleHash data", data)
-		outChannelMD5 := make(chan string, 100) // md5Sum := DataSignerMd5(data)
+// recoveredErr превращает результат recover() в ошибку стадии: ошибка из runAsJob
+// возвращается как была, остальное - PanicError без имени стадии
+func recoveredErr(r interface{}) error {
+	if je, ok := r.(jobError); ok {
+		return je.err
+	}
+	return newPanicError("", r)
+}
 
-		go func(jdata string, jout chan string) { //считает MD5()
-			mut.Lock()
-			md5Sum := DataSignerMd5(jdata)
-			mut.Unlock()
-			// fmt.Println(i, "SingleHash md5(data)", md5Sum) //0 SingleHash md5(data) cfcd208495d565ef66e7dff9f98764da
-			jout <- md5Sum
-			// fmt.Println("md5Sum routine finish")
-		}(data, outChannelMD5)
+// PanicError - паника внутри стадии, ExecutePipeline возвращает её как ошибку
+type PanicError struct {
+	Stage string
+	Value interface{}
+	Stack []byte // стек горутины в момент паники, в Error() не попадает
+}
 
-		wg1.Add(1)
-		go func(jwg1 *sync.WaitGroup, jin chan string, jout chan dataStruct, ji int) { //считает CRC32(MD5)
-			defer jwg1.Done()
-			jdata := <-jin
-			crc32MD5 := DataSignerCrc32(jdata)
-			jout <- dataStruct{indexNum: ji, dataString: crc32MD5}
-			// jout <- crc32MD5
-		}(wg1, outChannelMD5, outChannelCRC32MD5, i)
+func newPanicError(stage string, value interface{}) *PanicError {
+	return &PanicError{Stage: stage, Value: value, Stack: debug.Stack()}
+}
 
-		go func(jdata string, jout chan dataStruct, ji int) { //считает CRC32()
-			crc32Sum := DataSignerCrc32(jdata)
-			jout <- dataStruct{indexNum: ji, dataString: crc32Sum}
-		}(data, outChannelCRC32, i)
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in stage %s: %v", e.Stage, e.Value)
+}
 
-		i++
-	}
-	wg1.Wait() //ждём пока закончатся все вычисления CRC32 и MD5 - crc32(data) и crc32(md5(data))
-	close(outChannelCRC32MD5)
-	close(outChannelCRC32)
+// Unwrap - если паниковали с ошибкой, она доступна через errors.Is и errors.As
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// resourceMd5 - DataSignerMd5 можно вызывать только по одному, иначе перегрев на 1 сек
+const resourceMd5 = "DataSignerMd5"
 
-	crc32md5dataMap := make(map[int]string, 100)
-	crc32DataMap := make(map[int]string, 100)
+// signerResources - ресурсы с ограничением на одновременные вызовы
+var signerResources = NewScheduler()
 
-	for chData := range outChannelCRC32MD5 {
-		crc32md5dataMap[chData.indexNum] = chData.dataString
+func init() {
+	if err := signerResources.Register(resourceMd5, 1); err != nil {
+		panic(err)
 	}
-	for chData := range outChannelCRC32 {
-		crc32DataMap[chData.indexNum] = chData.dataString
+}
+
+// signMd5 вызывает DataSignerMd5, дождавшись своей очереди
+func signMd5(data string) string {
+	var md5Sum string
+	signerResources.Do(context.Background(), resourceMd5, func() { //без отмены ошибки не бывает
+		md5Sum = DataSignerMd5(data)
+	})
+	return md5Sum
+}
+
+// singleHashWindow - сколько значений SingleHash считает одновременно, ожидая самое раннее из них
+const singleHashWindow = MaxInputDataLen
+
+// multiHashWorkers - сколько значений MultiHash считает одновременно
+const multiHashWorkers = MaxInputDataLen
+
+// HashChain - из чего считаются SingleHash и MultiHash:
+// SingleHash = Outer(data)+"~"+Outer(Inner(data)), MultiHash = Outer(th+data) для th=0..5
+type HashChain struct {
+	Outer   Signer
+	Inner   Signer
+	Workers int  // сколько значений считается одновременно, 0 - MaxInputDataLen
+	Ordered bool // MultiHash отдаёт результаты в порядке входа, а не по готовности
+}
+
+// defaultChain - crc32 и md5 через DataSignerCrc32 и DataSignerMd5, как в задании
+var defaultChain = HashChain{
+	Outer: namedSigner{name: "crc32", Signer: SignerFunc(callCrc32)},
+	Inner: namedSigner{name: "md5", Signer: SignerFunc(callMd5)},
+}
+
+// NewHashChain собирает цепочку из зарегистрированных функций подписи, например "crc32" и "md5"
+func NewHashChain(outer, inner string) (HashChain, error) {
+	outerSigner, err := LookupSigner(outer)
+	if err != nil {
+		return HashChain{}, err
 	}
-	for key := range crc32md5dataMap {
-		outData := crc32DataMap[key] + "~" + crc32md5dataMap[key]
-		out <- outData
+	innerSigner, err := LookupSigner(inner)
+	if err != nil {
+		return HashChain{}, err
 	}
+	return HashChain{Outer: outerSigner, Inner: innerSigner}, nil
+}
 
-	// md5Sum := DataSignerMd5(data)
-	// data2 := DataSignerCrc32(md5Sum)
-	// data1 := DataSignerCrc32(data)
-	// out <- data1 + "~" + data2
+// WithSalt - цепочка, в которой соль salt добавляется к данным перед каждой функцией подписи.
+// В отличие от DataSignerSalt действует только на эту цепочку
+func (c HashChain) WithSalt(salt string) HashChain {
+	c.Outer, c.Inner = Salted(c.Outer, salt), Salted(c.Inner, salt)
+	return c
+}
 
+// WithKey - цепочка, в которой каждая функция подписи считается как HMAC с ключом key
+func (c HashChain) WithKey(key []byte) HashChain {
+	c.Outer, c.Inner = Keyed(c.Outer, key), Keyed(c.Inner, key)
+	return c
 }
 
-type dataStruct2 struct {
-	singleHashIndex int
-	dataS           dataStruct
+// SingleHash считает значение crc32(data)+"~"+crc32(md5(data)) ( конкатенация двух строк через ~), где data - то что пришло на вход (по сути - числа из первой функции)
+// результаты уходят дальше в порядке входа, каждый как только готов он и все предыдущие
+func SingleHash(in, out chan interface{}) {
+	defaultChain.SingleHash(in, out)
 }
 
 // MultiHash считает значение crc32(th+data)) (конкатенация цифры, приведённой к строке и строки), где th=0..5 ( т.е. 6 хешей на каждое входящее значение ),
 // потом берёт конкатенацию результатов в порядке расчета (0..5), где data - то что пришло на вход (и ушло на выход из SingleHash)
+// результат для значения уходит дальше сразу, как только посчитаны все 6 хешей
 func MultiHash(in, out chan interface{}) { //4108050209~502633748 MultiHash: crc32(th+step1)) 0 2956866606
-	wg := &sync.WaitGroup{}
-	outChannelCRC32 := make(chan dataStruct2, 100) // md5Sum := DataSignerMd5(data)
-	var ii int
-	for idata := range in { //обрабатывает каждое значение приходящее в канал
-		data := fmt.Sprintf("%v", idata) //переводим в string
-		for i := 0; i < 6; i++ {
-			wg.Add(1)
-			go func(jwg *sync.WaitGroup, jout chan dataStruct2, ji int, jii int) {
-				defer jwg.Done()
-				jdata := DataSignerCrc32(fmt.Sprintf("%v", ji) + data)
-				fmt.Println(data, "MultiHash: crc32(th+step1))", ji, jdata)
-				jout <- dataStruct2{singleHashIndex: jii, dataS: dataStruct{indexNum: ji, dataString: jdata}} //возвращаем i потока для сортировки и вычисленные данные
-			}(wg, outChannelCRC32, i, ii)
-		}
-		ii++
+	defaultChain.MultiHash(in, out)
+}
+
+// SingleHash - job SingleHash для этой цепочки
+func (c HashChain) SingleHash(in, out chan interface{}) {
+	runAsJob(c.SingleHashStage(), in, out)
+}
+
+// MultiHash - job MultiHash для этой цепочки
+func (c HashChain) MultiHash(in, out chan interface{}) {
+	runAsJob(c.MultiHashStage(), in, out)
+}
+
+// SingleHashStage - SingleHash как типизированная стадия
+func (c HashChain) SingleHashStage() Stage[interface{}, string] {
+	return ParallelOrdered(c.workers(singleHashWindow), func(ctx context.Context, idata interface{}) (string, error) {
+		return c.singleHash(fmt.Sprintf("%v", idata)), nil //data := (<-in).(string)
+	})
+}
+
+// MultiHashStage - MultiHash как типизированная стадия
+func (c HashChain) MultiHashStage() Stage[interface{}, string] {
+	fn := func(ctx context.Context, idata interface{}) (string, error) {
+		return c.multiHash(fmt.Sprintf("%v", idata)), nil //переводим в string
+	}
+	if c.Ordered {
+		return ParallelOrdered(c.workers(multiHashWorkers), fn)
 	}
-	wg.Wait() // ждём высчитывания всех CRC32
-	close(outChannelCRC32)
+	return Parallel(c.workers(multiHashWorkers), fn)
+}
 
-	var dataSl []dataStruct2
-	for outI := range outChannelCRC32 { //получаем данные из канала
-		dataSl = append(dataSl, outI)
+func (c HashChain) workers(def int) int {
+	if c.Workers > 0 {
+		return c.Workers
 	}
-	sort.SliceStable(dataSl, func(i, j int) bool { //сортируем выходные данные
-		if dataSl[i].singleHashIndex < dataSl[j].singleHashIndex {
-			return true
-		}
-		if dataSl[i].singleHashIndex > dataSl[j].singleHashIndex {
-			return false
-		}
-		return (dataSl[i].dataS.indexNum < dataSl[j].dataS.indexNum)
-	})
-	// fmt.Printf("\ndataSl %v\n", dataSl)
-
-	var outString string
-	var iiiiiii int
-	for _, value := range dataSl {
-		iiiiiii++
-		outString = outString + value.dataS.dataString
-		if iiiiiii == 6 {
-			out <- outString
-			outString = ""
-			iiiiiii = 0
-		}
+	return def
+}
+
+// singleHash считает SingleHash для одного значения, Outer(data) параллельно с Inner
+func (c HashChain) singleHash(data string) string {
+	var crc32Data string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		crc32Data = c.Outer.Sign(data) //считает CRC32()
+	}()
+	defer func() { <-done }() //если Inner паникует, горутина не должна считать после выхода стадии
+
+	md5Sum := c.Inner.Sign(data)
+	crc32MD5 := c.Outer.Sign(md5Sum) //считает CRC32(MD5)
+
+	<-done
+	return crc32Data + "~" + crc32MD5
+}
+
+// multiHashThreads - th=0..5 в MultiHash
+const multiHashThreads = 6
+
+// multiHash считает MultiHash для одного значения, все 6 хешей параллельно
+func (c HashChain) multiHash(data string) string {
+	dataSl := make([]string, multiHashThreads) //каждая горутина пишет в свою ячейку - сортировать не нужно
+	wg := &sync.WaitGroup{}
+	for th := 0; th < multiHashThreads; th++ {
+		wg.Add(1)
+		go func(th int) {
+			defer wg.Done()
+			dataSl[th] = c.Outer.Sign(strconv.Itoa(th) + data)
+		}(th)
 	}
+	wg.Wait()
+	return strings.Join(dataSl, "")
 }
 
 // CombineResults получает все результаты, сортирует (https://golang.org/pkg/sort/), объединяет отсортированный результат через _ (символ подчеркивания) в одну строку
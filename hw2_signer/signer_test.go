@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSignerExpected - результат TestSigner для входа 0, 1, 1, 2, 3, 5, 8
+const testSignerExpected = "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+
+// fastSigners подменяет DataSignerMd5 и DataSignerCrc32 на версии без задержек, соль учитывается как в common.go
+func fastSigners(t *testing.T) {
+	md5Orig, crc32Orig := DataSignerMd5, DataSignerCrc32
+	t.Cleanup(func() {
+		DataSignerMd5, DataSignerCrc32 = md5Orig, crc32Orig
+	})
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data+DataSignerSalt)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+DataSignerSalt))), 10)
+	}
+}
+
+func TestSingleHashStreams(t *testing.T) {
+	fastSigners(t)
+
+	firstSeen := make(chan struct{})
+	streamed := false
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- 0
+			select { //следующее значение не придёт, пока SingleHash не отдаст первое
+			case <-firstSeen:
+				streamed = true
+			case <-time.After(time.Second):
+			}
+			out <- 1
+		}),
+		job(SingleHash),
+		job(func(in, out chan interface{}) {
+			seen := false
+			for range in {
+				if !seen {
+					close(firstSeen)
+					seen = true
+				}
+			}
+		}),
+	)
+	if !streamed {
+		t.Errorf("SingleHash waited for the end of input")
+	}
+}
+
+func TestSingleHashOrder(t *testing.T) {
+	fastSigners(t)
+	crc32Fast := DataSignerCrc32
+	DataSignerCrc32 = func(data string) string {
+		if n, err := strconv.Atoi(data); err == nil {
+			time.Sleep(time.Duration(20-n) * time.Millisecond) //поздние значения считаются быстрее
+		}
+		return crc32Fast(data)
+	}
+
+	var result []string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 20; i++ {
+				out <- i
+			}
+		}),
+		job(SingleHash),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				result = append(result, val.(string))
+			}
+		}),
+	)
+
+	if len(result) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(result))
+	}
+	for i, val := range result {
+		data := strconv.Itoa(i)
+		expected := crc32Fast(data) + "~" + crc32Fast(DataSignerMd5(data))
+		if val != expected {
+			t.Errorf("result %d: got %v, expected %v", i, val, expected)
+		}
+	}
+}
+
+func TestMultiHashStreams(t *testing.T) {
+	fastSigners(t)
+
+	var ok = true
+	var recieved uint32
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- "4108050209~502633748"
+			time.Sleep(10 * time.Millisecond)
+			// как в TestPipeline: результат первого значения должен дойти
+			// до следующей стадии раньше, чем закончится вход
+			if atomic.LoadUint32(&recieved) == 0 {
+				ok = false
+			}
+			out <- "2212294583~709660146"
+		}),
+		job(MultiHash),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				if val != "29568666068035183841425683795340791879727309630931025356555" &&
+					val != "4958044192186797981418233587017209679042592862002427381542" {
+					t.Errorf("unexpected MultiHash result %v", val)
+				}
+				atomic.AddUint32(&recieved, 1)
+			}
+		}),
+	)
+	if !ok || recieved != 2 {
+		t.Errorf("no value free flow - dont collect them, recieved = %d", recieved)
+	}
+}
+
+func TestMultiHashManyInputs(t *testing.T) {
+	fastSigners(t)
+	const inputLen = MaxInputDataLen * 10
+
+	var recieved int
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < inputLen; i++ {
+				out <- i
+			}
+		}),
+		job(MultiHash),
+		job(func(in, out chan interface{}) {
+			for range in {
+				recieved++
+			}
+		}),
+	)
+	if recieved != inputLen {
+		t.Errorf("expected %d results, got %d", inputLen, recieved)
+	}
+}
+
+func TestSignerFast(t *testing.T) {
+	fastSigners(t)
+
+	var result string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range []int{0, 1, 1, 2, 3, 5, 8} {
+				out <- fibNum
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	if result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+}
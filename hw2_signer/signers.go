@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Signer - функция подписи, из которой собирается HashChain
+type Signer interface {
+	Sign(data string) string
+}
+
+// SignerFunc позволяет использовать обычную функцию как Signer
+type SignerFunc func(data string) string
+
+// Sign вызывает f(data)
+func (f SignerFunc) Sign(data string) string {
+	return f(data)
+}
+
+var (
+	signersMu sync.RWMutex
+	signers   = map[string]Signer{}
+)
+
+func init() {
+	RegisterSigner("crc32", SignerFunc(callCrc32)) //DataSignerCrc32, через кеш, если он включён
+	RegisterSigner("md5", SignerFunc(callMd5))     //DataSignerMd5, по одному вызову за раз
+	RegisterSigner("sha256", SignerFunc(func(data string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	}))
+	RegisterSigner("fnv", SignerFunc(func(data string) string {
+		h := fnv.New32a()
+		h.Write([]byte(data))
+		return strconv.FormatUint(uint64(h.Sum32()), 10)
+	}))
+}
+
+// RegisterSigner добавляет функцию подписи под именем name, заменяя прежнюю с тем же именем
+func RegisterSigner(name string, s Signer) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	signers[name] = s
+}
+
+// LookupSigner возвращает функцию подписи по имени
+func LookupSigner(name string) (Signer, error) {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	s, ok := signers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q, known: %v", name, signerNamesLocked())
+	}
+	return namedSigner{name: name, Signer: s}, nil
+}
+
+// describer - функция подписи, которая может описать себя для HashChain.Fingerprint
+type describer interface {
+	describe() string
+}
+
+// describeSigner - описание s, "" - если s не умеет себя описать (например, безымянная SignerFunc)
+func describeSigner(s Signer) string {
+	if d, ok := s.(describer); ok {
+		return d.describe()
+	}
+	return ""
+}
+
+// namedSigner - функция подписи из реестра, её описание - имя
+type namedSigner struct {
+	Signer
+	name string
+}
+
+func (s namedSigner) describe() string {
+	return strconv.Quote(s.name)
+}
+
+// SignerNames - имена зарегистрированных функций подписи по алфавиту
+func SignerNames() []string {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	return signerNamesLocked()
+}
+
+func signerNamesLocked() []string {
+	names := make([]string, 0, len(signers))
+	for name := range signers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Salted добавляет salt к данным перед s, как DataSignerSalt, но только для одной цепочки
+func Salted(s Signer, salt string) Signer {
+	if salt == "" {
+		return s
+	}
+	return saltedSigner{s: s, salt: salt}
+}
+
+type saltedSigner struct {
+	s    Signer
+	salt string
+}
+
+func (s saltedSigner) Sign(data string) string {
+	return s.s.Sign(data + s.salt)
+}
+
+func (s saltedSigner) describe() string {
+	if desc := describeSigner(s.s); desc != "" {
+		return fmt.Sprintf("salted(%s,%q)", desc, s.salt)
+	}
+	return ""
+}
+
+// hmacBlockSize - размер блока ключа HMAC, как у md5 и sha256
+const hmacBlockSize = 64
+
+// Keyed - s в режиме HMAC (RFC 2104): s(key^opad + s(key^ipad + data)).
+// Хешем служит сама s, поэтому на каждое значение она вызывается дважды
+func Keyed(s Signer, key []byte) Signer {
+	keySum := sha256.Sum256(key) //в описание идёт хеш ключа, а не сам ключ
+	if len(key) > hmacBlockSize {
+		key = []byte(s.Sign(string(key)))
+	}
+	ipad := make([]byte, hmacBlockSize)
+	opad := make([]byte, hmacBlockSize)
+	copy(ipad, key)
+	copy(opad, key)
+	for i := range ipad {
+		ipad[i] ^= 0x36
+		opad[i] ^= 0x5c
+	}
+	return keyedSigner{s: s, inner: string(ipad), outer: string(opad), keySum: hex.EncodeToString(keySum[:])}
+}
+
+type keyedSigner struct {
+	s            Signer
+	inner, outer string //key^ipad и key^opad
+	keySum       string
+}
+
+func (s keyedSigner) Sign(data string) string {
+	return s.s.Sign(s.outer + s.s.Sign(s.inner+data))
+}
+
+func (s keyedSigner) describe() string {
+	if desc := describeSigner(s.s); desc != "" {
+		return fmt.Sprintf("keyed(%s,%s)", desc, s.keySum)
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// signChain прогоняет inputs через SingleHash, MultiHash и CombineResults цепочки
+func signChain(chain HashChain, inputs []int) string {
+	var result string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, val := range inputs {
+				out <- val
+			}
+		}),
+		job(chain.SingleHash),
+		job(chain.MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	return result
+}
+
+func TestHashChainDefault(t *testing.T) {
+	fastSigners(t)
+	chain, err := NewHashChain("crc32", "md5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := signChain(chain, []int{0, 1, 1, 2, 3, 5, 8}); result != testSignerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testSignerExpected)
+	}
+}
+
+func TestHashChainBackends(t *testing.T) {
+	chain, err := NewHashChain("fnv", "sha256")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	outer, inner := chain.Outer.Sign, chain.Inner.Sign
+	var parts []string
+	for _, val := range []int{0, 1} {
+		data := strconv.Itoa(val)
+		single := outer(data) + "~" + outer(inner(data))
+		var multi string
+		for th := 0; th < 6; th++ {
+			multi += outer(strconv.Itoa(th) + single)
+		}
+		parts = append(parts, multi)
+	}
+	sort.Strings(parts)
+	expected := strings.Join(parts, "_")
+
+	if result := signChain(chain, []int{0, 1}); result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	if inner("0") != "5feceb66ffc86f38d952786c6d696c79c2dbc239dd4e91b46729d73a27fb57e9" {
+		t.Errorf("unexpected sha256: %v", inner("0"))
+	}
+}
+
+// registerTestSigner регистрирует функцию подписи на время теста и возвращает реестр как был
+func registerTestSigner(t *testing.T, name string, s Signer) {
+	signersMu.RLock()
+	prev, existed := signers[name]
+	signersMu.RUnlock()
+	RegisterSigner(name, s)
+	t.Cleanup(func() {
+		signersMu.Lock()
+		defer signersMu.Unlock()
+		if existed {
+			signers[name] = prev
+		} else {
+			delete(signers, name)
+		}
+	})
+}
+
+func TestSignerRegistry(t *testing.T) {
+	if _, err := NewHashChain("crc32", "nope"); err == nil {
+		t.Errorf("expected error for unknown signer")
+	}
+	registerTestSigner(t, "upper", SignerFunc(strings.ToUpper))
+	s, err := LookupSigner("upper")
+	if err != nil || s.Sign("abc") != "ABC" {
+		t.Errorf("custom signer not registered: %v", err)
+	}
+	if names := strings.Join(SignerNames(), ","); names != "crc32,fnv,md5,sha256,upper" {
+		t.Errorf("unexpected signer names %v", names)
+	}
+}
+
+// signConcurrently считает подписи всех цепочек одновременно, каждую по rounds раз
+func signConcurrently(t *testing.T, chains map[string]HashChain, inputs []int, rounds int) map[string]string {
+	mu := sync.Mutex{}
+	results := map[string]string{}
+	wg := &sync.WaitGroup{}
+	for name, chain := range chains {
+		for i := 0; i < rounds; i++ {
+			wg.Add(1)
+			go func(name string, chain HashChain) {
+				defer wg.Done()
+				result := signChain(chain, inputs)
+				mu.Lock()
+				defer mu.Unlock()
+				if prev, ok := results[name]; ok && prev != result {
+					t.Errorf("%s: got different signatures %v and %v", name, prev, result)
+				}
+				results[name] = result
+			}(name, chain)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+func TestHashChainSalt(t *testing.T) {
+	fastSigners(t)
+	inputs := []int{0, 1, 1, 2, 3, 5, 8}
+
+	// с глобальной солью - по очереди, цепочки со своей солью - одновременно
+	salts := []string{"", "pepper", "salt"}
+	expected := map[string]string{}
+	for _, salt := range salts {
+		DataSignerSalt = salt
+		expected[salt] = signChain(defaultChain, inputs)
+	}
+	DataSignerSalt = ""
+	if expected[""] != testSignerExpected || expected["pepper"] == expected["salt"] {
+		t.Fatalf("unexpected signatures %v", expected)
+	}
+
+	chains := map[string]HashChain{}
+	for _, salt := range salts {
+		chains[salt] = defaultChain.WithSalt(salt)
+	}
+	for salt, result := range signConcurrently(t, chains, inputs, 3) {
+		if result != expected[salt] {
+			t.Errorf("salt %q: results not match\nGot: %v\nExpected: %v", salt, result, expected[salt])
+		}
+	}
+}
+
+func TestHashChainKey(t *testing.T) {
+	fastSigners(t)
+	inputs := []int{0, 1, 2}
+
+	chains := map[string]HashChain{
+		"plain": defaultChain,
+		"k1":    defaultChain.WithKey([]byte("k1")),
+		"k2":    defaultChain.WithKey([]byte("k2")),
+		"long":  defaultChain.WithKey(bytes.Repeat([]byte("k"), 100)),
+	}
+	results := signConcurrently(t, chains, inputs, 3)
+	seen := map[string]string{}
+	for name, result := range results {
+		if other, ok := seen[result]; ok {
+			t.Errorf("%s and %s produced the same signature", name, other)
+		}
+		seen[result] = name
+	}
+	if again := signChain(defaultChain.WithKey([]byte("k1")), inputs); again != results["k1"] {
+		t.Errorf("keyed signature is not stable")
+	}
+}
+
+func TestKeyedSigner(t *testing.T) {
+	wrap := SignerFunc(func(data string) string { return "(" + data + ")" })
+	ipad := []byte(strings.Repeat("\x36", hmacBlockSize))
+	opad := []byte(strings.Repeat("\x5c", hmacBlockSize))
+	ipad[0] ^= 'k'
+	opad[0] ^= 'k'
+	expected := "(" + string(opad) + "(" + string(ipad) + "data))"
+	if got := Keyed(wrap, []byte("k")).Sign("data"); got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if got := Salted(wrap, "+salt").Sign("data"); got != "(data+salt)" {
+		t.Errorf("got %q", got)
+	}
+}
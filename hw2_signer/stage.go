@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stage - типизированная стадия конвейера
+type Stage[In, Out any] func(ctx context.Context, in <-chan In, out chan<- Out) error
+
+// Pipe - цепочка стадий от In к Out, собирается через NewPipe и Then,
+// поэтому несовпадение выхода одной стадии и входа следующей не скомпилируется
+type Pipe[In, Out any] struct {
+	jobs []jobCtx
+}
+
+// NewPipe начинает цепочку с одной стадии
+func NewPipe[In, Out any](s Stage[In, Out]) Pipe[In, Out] {
+	return Pipe[In, Out]{jobs: []jobCtx{s.Job()}}
+}
+
+// Then добавляет в конец цепочки стадию, вход которой совпадает с выходом цепочки
+func Then[In, Mid, Out any](p Pipe[In, Mid], s Stage[Mid, Out]) Pipe[In, Out] {
+	jobs := make([]jobCtx, 0, len(p.jobs)+1)
+	jobs = append(jobs, p.jobs...)
+	return Pipe[In, Out]{jobs: append(jobs, s.Job())}
+}
+
+// Jobs возвращает стадии цепочки для ExecutePipelineContext
+func (p Pipe[In, Out]) Jobs() []jobCtx {
+	return p.jobs
+}
+
+// Run прогоняет inputs через цепочку и собирает всё, что вышло из последней стадии
+func (p Pipe[In, Out]) Run(ctx context.Context, inputs []In) ([]Out, error) {
+	var result []Out
+	jobs := make([]jobCtx, 0, len(p.jobs)+2)
+	jobs = append(jobs, func(ctx context.Context, in, out chan interface{}) error {
+		for _, val := range inputs {
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	jobs = append(jobs, p.jobs...)
+	jobs = append(jobs, func(ctx context.Context, in, out chan interface{}) error {
+		for val := range in {
+			typed, ok := val.(Out)
+			if !ok {
+				return fmt.Errorf("pipe output: unexpected %T", val)
+			}
+			result = append(result, typed)
+		}
+		return nil
+	})
+	err := ExecutePipelineContext(ctx, jobs...)
+	return result, err
+}
+
+// Job превращает типизированную стадию в jobCtx, значения приводятся к In на входе
+func (s Stage[In, Out]) Job() jobCtx {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		typedIn := make(chan In)
+		typedOut := make(chan Out)
+		stageDone := make(chan struct{})
+		errCh := make(chan error, 2)
+
+		go func() {
+			defer close(typedOut)
+			defer close(stageDone)
+			defer func() {
+				if r := recover(); r != nil { //имя стадии подставит startWorker
+					errCh <- recoveredErr(r)
+				}
+			}()
+			errCh <- s(ctx, typedIn, typedOut)
+		}()
+		go func() {
+			defer close(typedIn)
+			for val := range in {
+				typed, ok := val.(In)
+				if !ok {
+					errCh <- fmt.Errorf("stage input: unexpected %T", val)
+					return
+				}
+				select {
+				case typedIn <- typed:
+				case <-stageDone: //стадия закончила раньше, чем вход
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		for val := range typedOut {
+			out <- val
+		}
+		if err := <-errCh; err != nil {
+			return err
+		}
+		select {
+		case err := <-errCh: //ошибка приведения типа, если была
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+// FromJob делает типизированную стадию из старого job, выход приводится к Out
+func FromJob[In, Out any](freeFlowJob job) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In, out chan<- Out) error {
+		untypedIn := make(chan interface{})
+		untypedOut := make(chan interface{})
+		go func() {
+			defer close(untypedIn)
+			for val := range in {
+				untypedIn <- val
+			}
+		}()
+		go func() {
+			defer close(untypedOut)
+			freeFlowJob(untypedIn, untypedOut)
+		}()
+
+		var err error
+		for val := range untypedOut {
+			typed, ok := val.(Out)
+			if !ok {
+				if err == nil {
+					err = fmt.Errorf("job output: unexpected %T", val)
+				}
+				continue
+			}
+			if err == nil {
+				out <- typed
+			}
+		}
+		return err
+	}
+}
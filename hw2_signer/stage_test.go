@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestPipeTyped(t *testing.T) {
+	itoa := Stage[int, string](func(ctx context.Context, in <-chan int, out chan<- string) error {
+		for val := range in {
+			out <- strconv.Itoa(val)
+		}
+		return nil
+	})
+	// Then(p, FromJob[int, string](...)) не скомпилируется - на выходе p уже string
+	p := Then(NewPipe(itoa), FromJob[string, string](CombineResults))
+
+	result, err := p.Run(context.Background(), []int{8, 0, 1, 1, 2, 3, 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 1 || result[0] != "0_1_1_2_3_5_8" {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, "0_1_1_2_3_5_8")
+	}
+}
+
+func TestPipeWrongInput(t *testing.T) {
+	double := Stage[int, int](func(ctx context.Context, in <-chan int, out chan<- int) error {
+		for val := range in {
+			out <- val * 2
+		}
+		return nil
+	})
+	// старый job может прислать что угодно - ошибка видна только во время работы
+	jobs := append([]jobCtx{adaptJob(func(in, out chan interface{}) {
+		out <- "not an int"
+	})}, NewPipe(double).Jobs()...)
+	if err := ExecutePipelineContext(context.Background(), jobs...); err == nil {
+		t.Errorf("expected type error")
+	}
+
+	result, err := NewPipe(double).Run(context.Background(), []int{1, 2, 3})
+	if err != nil || len(result) != 3 || result[2] != 6 {
+		t.Errorf("unexpected result %v, err %v", result, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tracer собирает события конвейера в формате Chrome trace-event,
+// результат WriteJSON открывается в chrome://tracing или ui.perfetto.dev.
+// Каждая стадия - отдельный поток, обработка значения - асинхронный отрезок,
+// поэтому параллельно обрабатываемые значения видны друг под другом
+type Tracer struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []traceEvent
+}
+
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"` //микросекунды
+	Dur  int64                  `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	ID   string                 `json:"id,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// NewTracer создаёт пустую трассировку, время считается от её создания
+func NewTracer() *Tracer {
+	return &Tracer{start: time.Now()}
+}
+
+// WriteJSON записывает трассировку в формате Chrome trace-event
+func (t *Tracer) WriteJSON(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.events
+	if events == nil {
+		events = []traceEvent{}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{events})
+}
+
+// методы ниже можно вызывать у nil - трассировка выключена
+
+func (t *Tracer) add(ev traceEvent) {
+	if t == nil {
+		return
+	}
+	ev.Pid = 1
+	t.mu.Lock()
+	t.events = append(t.events, ev)
+	t.mu.Unlock()
+}
+
+func (t *Tracer) ts(at time.Time) int64 {
+	return at.Sub(t.start).Microseconds()
+}
+
+func (t *Tracer) threadName(tid int, name string) {
+	t.add(traceEvent{Name: "thread_name", Ph: "M", Tid: tid, Args: map[string]interface{}{"name": name}})
+}
+
+func (t *Tracer) complete(tid int, name string, start time.Time, dur time.Duration) {
+	if t == nil {
+		return
+	}
+	t.add(traceEvent{Name: name, Cat: "stage", Ph: "X", Ts: t.ts(start), Dur: dur.Microseconds(), Tid: tid})
+}
+
+func (t *Tracer) asyncBegin(tid int, name string, seq int, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.add(traceEvent{Name: name, Cat: "item", Ph: "b", Ts: t.ts(at), Tid: tid, ID: strconv.Itoa(tid) + "-" + strconv.Itoa(seq)})
+}
+
+func (t *Tracer) asyncEnd(tid int, name string, seq int, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.add(traceEvent{Name: name, Cat: "item", Ph: "e", Ts: t.ts(at), Tid: tid, ID: strconv.Itoa(tid) + "-" + strconv.Itoa(seq)})
+}
+
+func (t *Tracer) counter(tid int, name string, value int, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.add(traceEvent{Name: name, Ph: "C", Ts: t.ts(at), Tid: tid, Args: map[string]interface{}{"depth": value}})
+}
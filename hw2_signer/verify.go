@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VerifyReport - результат проверки подписи CombineResults по набору входов
+type VerifyReport struct {
+	Valid    bool
+	Expected string       // подпись, пересчитанная по входам
+	Items    []VerifyItem // по одному на вход, в порядке входа
+	Extra    []int        // номера частей подписи, которым не нашлось входа
+	Parts    []string     // части проверяемой подписи
+}
+
+// VerifyItem - часть подписи, которая соответствует одному входу.
+// CombineResults сортирует части, поэтому номер части и номер входа не совпадают
+type VerifyItem struct {
+	Input string
+	Part  string // MultiHash входа
+	Index int    // номер части в подписи, -1 - такой части нет
+}
+
+// Failed возвращает входы, для которых в подписи не нашлось части
+func (r *VerifyReport) Failed() []VerifyItem {
+	var failed []VerifyItem
+	for _, item := range r.Items {
+		if item.Index < 0 {
+			failed = append(failed, item)
+		}
+	}
+	return failed
+}
+
+// Err описывает первое несовпадение, nil - подпись верна
+func (r *VerifyReport) Err() error {
+	if r.Valid {
+		return nil
+	}
+	for i, item := range r.Items {
+		if item.Index < 0 {
+			return fmt.Errorf("verify: input %d (%q): part %s not found in signature", i, item.Input, item.Part)
+		}
+	}
+	if len(r.Extra) > 0 {
+		return fmt.Errorf("verify: signature part %d (%s) does not match any input", r.Extra[0], r.Parts[r.Extra[0]])
+	}
+	return fmt.Errorf("verify: signature parts are not in CombineResults order")
+}
+
+// Verify пересчитывает подпись inputs через SingleHash и MultiHash и сверяет её с signature
+func Verify(inputs []string, signature string) (*VerifyReport, error) {
+	return defaultChain.Verify(context.Background(), inputs, signature)
+}
+
+// Verify - Verify для этой цепочки
+func (c HashChain) Verify(ctx context.Context, inputs []string, signature string) (*VerifyReport, error) {
+	report := &VerifyReport{Items: make([]VerifyItem, len(inputs))}
+	err := c.SignEach(ctx, inputs, func(i int, part string) error {
+		report.Items[i] = VerifyItem{Input: inputs[i], Part: part, Index: -1}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if signature != "" {
+		report.Parts = strings.Split(signature, "_")
+	}
+	byPart := map[string][]int{} //часть -> её номера в подписи, части могут повторяться
+	for i, part := range report.Parts {
+		byPart[part] = append(byPart[part], i)
+	}
+	expected := make([]string, len(inputs))
+	for i := range report.Items {
+		item := &report.Items[i]
+		expected[i] = item.Part
+		if idx := byPart[item.Part]; len(idx) > 0 {
+			item.Index, byPart[item.Part] = idx[0], idx[1:]
+		}
+	}
+	for _, idx := range byPart {
+		report.Extra = append(report.Extra, idx...)
+	}
+	sort.Ints(report.Extra)
+
+	sort.Strings(expected) //как в CombineResults
+	report.Expected = strings.Join(expected, "_")
+	report.Valid = report.Expected == signature
+	return report, nil
+}
+
+// SignEach считает MultiHash(SingleHash) каждого входа и вызывает fn с номером входа в порядке входа
+func (c HashChain) SignEach(ctx context.Context, inputs []string, fn func(i int, part string) error) error {
+	_, err := c.signEach(ctx, PipelineOptions{}, inputs, nil, fn)
+	return err
+}
+
+// signEach - SignEach с настройками конвейера, journal != nil - готовые значения берутся из журнала
+func (c HashChain) signEach(ctx context.Context, opts PipelineOptions, inputs []string, journal *Journal, fn func(i int, part string) error) (*PipelineResult, error) {
+	c.Ordered = true //чтобы сопоставить результат со входом
+	var i int
+	jobs := append([]jobCtx{sourceJob(inputs)}, c.signStages(journal)...)
+	jobs = append(jobs, func(ctx context.Context, in, out chan interface{}) error {
+		for val := range in {
+			if err := fn(i, val.(string)); err != nil {
+				return err
+			}
+			i++
+		}
+		return nil
+	})
+	return ExecutePipelineOpts(ctx, opts, jobs...)
+}
+
+// sourceJob отдаёт inputs в конвейер
+func sourceJob(inputs []string) jobCtx {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		for _, val := range inputs {
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	fastSigners(t)
+
+	inputs := []string{"0", "1", "1", "2", "3", "5", "8"}
+	report, err := Verify(inputs, testSignerExpected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Err() != nil || len(report.Extra) != 0 {
+		t.Fatalf("valid signature rejected: %v", report.Err())
+	}
+	parts := strings.Split(testSignerExpected, "_")
+	used := map[int]bool{}
+	for i, item := range report.Items {
+		if item.Index < 0 || parts[item.Index] != item.Part || used[item.Index] {
+			t.Errorf("input %d mapped to part %d", i, item.Index)
+		}
+		used[item.Index] = true
+	}
+	// "1" дважды - и обе части должны достаться разным входам
+	if report.Items[1].Index == report.Items[2].Index {
+		t.Errorf("duplicate inputs mapped to the same part")
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	fastSigners(t)
+
+	inputs := []string{"0", "1", "1", "2", "4", "5", "8"} //3 заменили на 4
+	report, err := Verify(inputs, testSignerExpected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid {
+		t.Fatalf("invalid signature accepted")
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Input != "4" {
+		t.Errorf("failed inputs: %+v", failed)
+	}
+	if len(report.Extra) != 1 || report.Parts[report.Extra[0]] != defaultChain.multiHash(defaultChain.singleHash("3")) {
+		t.Errorf("extra parts: %v", report.Extra)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), `input 4 ("4")`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyOrder(t *testing.T) {
+	fastSigners(t)
+
+	parts := strings.Split(testSignerExpected, "_")
+	parts[0], parts[len(parts)-1] = parts[len(parts)-1], parts[0]
+	report, err := Verify([]string{"0", "1", "1", "2", "3", "5", "8"}, strings.Join(parts, "_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || len(report.Failed()) != 0 || len(report.Extra) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Expected != testSignerExpected {
+		t.Errorf("expected signature %q", report.Expected)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	fastSigners(t)
+
+	out := &bytes.Buffer{}
+	ok, err := runVerify(context.Background(), defaultChain, []string{"0", "1"}, "x_"+defaultChain.multiHash(defaultChain.singleHash("1")), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("invalid signature accepted")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		`FAIL input 0 "0": part ` + defaultChain.multiHash(defaultChain.singleHash("0")) + " not in signature",
+		`ok   input 1 "1": part 1`,
+		`FAIL part 0 x: no matching input`,
+	}
+	if !reflect.DeepEqual(lines[:3], expected) {
+		t.Errorf("got:\n%s", out)
+	}
+}